@@ -1,12 +1,13 @@
 package main
 
 import (
-	"encoding/binary"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"strconv"
+	"io"
 	"strings"
+	"vencord/asar"
 )
 
 var PackageJson = `{
@@ -14,64 +15,88 @@ var PackageJson = `{
 	"main": "index.js"
 }`
 
-type asarEntry struct {
-	Size   int32  `json:"size"`
-	Offset string `json:"offset"`
-}
-
-// Ported from https://github.com/GeopJr/asar-cr/blob/cd7695b7c913bf921d9fb6600eaeb1400e3ba225/src/asar-cr/pack.cr#L61
-
+// WriteAppAsar writes the stub app.asar that loads equicordAsarPath, after
+// reading it back to make sure Discord will find what we expect.
 func WriteAppAsar(outFile string, equicordAsarPath string) error {
-	header := make(map[string]map[string]asarEntry)
-	files := make(map[string]asarEntry)
-	header["files"] = files
-
-	fileContents := ""
-
 	patcherPathB, _ := json.Marshal(equicordAsarPath)
 	indexJsContents := "require(" + string(patcherPathB) + ")"
-	indexJsBytes := len([]byte(indexJsContents))
-	fileContents += indexJsContents
-	files["index.js"] = asarEntry{
-		Size:   int32(indexJsBytes),
-		Offset: "0",
+
+	w := asar.NewWriter()
+	if err := w.AddBytes("index.js", []byte(indexJsContents), asar.FileOptions{}); err != nil {
+		return err
+	}
+	if err := w.AddBytes("package.json", []byte(PackageJson), asar.FileOptions{}); err != nil {
+		return err
+	}
+	b, err := w.Bytes()
+	if err != nil {
+		return err
 	}
 
-	fileContents += PackageJson
-	files["package.json"] = asarEntry{
-		Size:   int32(len([]byte(PackageJson))),
-		Offset: strconv.Itoa(indexJsBytes),
+	a, err := asar.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("Failed to read back %s: %w", outFile, err)
 	}
 
-	headerBytes, _ := json.Marshal(header)
-	headerString := string(headerBytes)
-	headerStringSize := uint32(len(headerString))
-	dataSize := uint32(4)
-	alignedSize := (headerStringSize + dataSize - 1) & ^(dataSize - 1)
-	headerSize := alignedSize + 8
-	headerObjectSize := alignedSize + dataSize
-	diff := alignedSize - headerStringSize
-	if diff > 0 {
-		headerString += strings.Repeat("0", int(diff))
+	if err = a.Verify(); err != nil {
+		return fmt.Errorf("Failed to verify %s: %w", outFile, err)
 	}
+	if b, err := a.ReadFile("index.js"); err != nil || string(b) != indexJsContents {
+		return errors.New("Failed to verify " + outFile + ": index.js does not match what was written")
+	}
+
+	return FS.WriteFile(outFile, b, 0644)
+}
 
-	f, err := os.Create(outFile)
+// ReadAsarMain returns the contents of the entrypoint declared in the
+// package.json of the archive at asarPath, without reading the rest of it
+func ReadAsarMain(asarPath string) ([]byte, error) {
+	a, closer, err := openAsar(asarPath)
 	if err != nil {
-		return fmt.Errorf("Failed to create %s: %w", outFile, err)
+		return nil, err
 	}
-	defer f.Close()
+	defer closer.Close()
 
-	for _, n := range []uint32{dataSize, headerSize, headerObjectSize, headerStringSize} {
-		if err = binary.Write(f, binary.LittleEndian, int32(n)); err != nil {
-			return fmt.Errorf("Failed to write asar bytes: %w", err)
+	main := "index.js"
+	if b, err := a.ReadFile("package.json"); err == nil {
+		var pkg struct {
+			Main string `json:"main"`
+		}
+		if json.Unmarshal(b, &pkg) == nil && pkg.Main != "" {
+			main = pkg.Main
 		}
 	}
 
-	for _, s := range []string{headerString, fileContents} {
-		if _, err = f.WriteString(s); err != nil {
-			return fmt.Errorf("Failed to write asar data: %w", err)
-		}
+	return a.ReadFile(main)
+}
+
+// openAsar opens the archive at name through FS. Close the returned closer,
+// not the archive
+func openAsar(name string) (*asar.Archive, io.Closer, error) {
+	f, err := FS.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := asar.NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return a, f, nil
+}
+
+// ReadAppAsarTarget returns the path the stub app.asar at asarPath loads, as
+// written by WriteAppAsar
+func ReadAppAsarTarget(asarPath string) (string, error) {
+	b, err := ReadAsarMain(asarPath)
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	s := strings.TrimSpace(string(b))
+	var target string
+	if !strings.HasPrefix(s, "require(") || !strings.HasSuffix(s, ")") || json.Unmarshal([]byte(s[len("require("):len(s)-1]), &target) != nil {
+		return "", errors.New(asarPath + " is not a Bashcord app.asar")
+	}
+	return target, nil
 }
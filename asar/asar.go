@@ -0,0 +1,184 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+// Package asar reads and writes Electron asar archives.
+//
+// An archive starts with two Chromium Pickles: the first one only holds the
+// size of the second, which in turn holds the JSON header describing the file
+// tree. File contents follow the header, concatenated in header order.
+// Entries marked as unpacked live next to the archive in "<archive>.unpacked".
+package asar
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidHeader = errors.New("asar: invalid header")
+
+// Entry is a node of the archive header. Directories have a non-nil Files map,
+// links have a non-empty Link, everything else is a regular file.
+type Entry struct {
+	Files      map[string]*Entry
+	Size       int64
+	Offset     int64
+	Unpacked   bool
+	Executable bool
+	Link       string
+	Integrity  *Integrity
+}
+
+type Integrity struct {
+	Algorithm string   `json:"algorithm"`
+	Hash      string   `json:"hash"`
+	BlockSize int      `json:"blockSize"`
+	Blocks    []string `json:"blocks"`
+}
+
+type rawEntry struct {
+	Files      map[string]*Entry `json:"files,omitempty"`
+	Size       int64             `json:"size,omitempty"`
+	Offset     string            `json:"offset,omitempty"`
+	Unpacked   bool              `json:"unpacked,omitempty"`
+	Executable bool              `json:"executable,omitempty"`
+	Link       string            `json:"link,omitempty"`
+	Integrity  *Integrity        `json:"integrity,omitempty"`
+}
+
+func (e *Entry) IsDir() bool {
+	return e.Files != nil
+}
+
+func (e *Entry) IsLink() bool {
+	return e.Link != ""
+}
+
+func (e *Entry) MarshalJSON() ([]byte, error) {
+	switch {
+	case e.IsDir():
+		m := map[string]any{"files": e.Files}
+		if e.Unpacked {
+			m["unpacked"] = true
+		}
+		return json.Marshal(m)
+	case e.IsLink():
+		return json.Marshal(map[string]string{"link": e.Link})
+	}
+
+	m := map[string]any{"size": e.Size}
+	if e.Unpacked {
+		m["unpacked"] = true
+	} else {
+		m["offset"] = strconv.FormatInt(e.Offset, 10)
+	}
+	if e.Executable {
+		m["executable"] = true
+	}
+	if e.Integrity != nil {
+		m["integrity"] = e.Integrity
+	}
+	return json.Marshal(m)
+}
+
+func (e *Entry) UnmarshalJSON(b []byte) error {
+	var raw rawEntry
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	*e = Entry{
+		Files:      raw.Files,
+		Size:       raw.Size,
+		Unpacked:   raw.Unpacked,
+		Executable: raw.Executable,
+		Link:       raw.Link,
+		Integrity:  raw.Integrity,
+	}
+	if raw.Offset != "" {
+		offset, err := strconv.ParseInt(raw.Offset, 10, 64)
+		if err != nil || offset < 0 {
+			return errors.New("asar: invalid offset " + strconv.Quote(raw.Offset))
+		}
+		e.Offset = offset
+	}
+	return nil
+}
+
+// splitPath turns an archive path into its components. Both / and \ are
+// accepted as separators, and paths may not escape the archive root.
+func splitPath(name string) ([]string, error) {
+	name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	if name == "/" {
+		return nil, nil
+	}
+	parts := strings.Split(name[1:], "/")
+	for _, p := range parts {
+		if p == ".." {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+		}
+	}
+	return parts, nil
+}
+
+// find looks up name below root without following links
+func find(root *Entry, name string) (*Entry, error) {
+	parts, err := splitPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	e := root
+	for _, p := range parts {
+		if !e.IsDir() {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		child, ok := e.Files[p]
+		if !ok {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		e = child
+	}
+	return e, nil
+}
+
+// WalkFunc is called for every entry of an archive. Like with fs.WalkDirFunc,
+// returning fs.SkipDir from a directory skips its children, and from a file
+// skips the rest of its parent directory.
+type WalkFunc func(name string, e *Entry) error
+
+// walk visits all entries below e in lexical order, parents before children
+func walk(e *Entry, name string, fn WalkFunc) error {
+	names := make([]string, 0, len(e.Files))
+	for n := range e.Files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		child := e.Files[n]
+		childName := path.Join(name, n)
+		if err := fn(childName, child); err != nil {
+			if !errors.Is(err, fs.SkipDir) {
+				return err
+			}
+			if !child.IsDir() {
+				return nil
+			}
+			continue
+		}
+		if child.IsDir() {
+			if err := walk(child, childName, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
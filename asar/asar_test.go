@@ -0,0 +1,268 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package asar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func readAll(t *testing.T, a *Archive, name string) string {
+	t.Helper()
+	b, err := a.ReadFile(name)
+	if err != nil {
+		t.Fatalf("reading %s: %v", name, err)
+	}
+	return string(b)
+}
+
+func TestRoundTrip(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "app.asar")
+
+	w := NewWriter()
+	for _, err := range []error{
+		w.AddBytes("package.json", []byte(`{"main":"index.js"}`), FileOptions{}),
+		w.AddBytes("index.js", []byte("console.log(1)"), FileOptions{}),
+		w.AddBytes("bin/run", []byte("#!/bin/sh"), FileOptions{Executable: true}),
+		w.AddBytes("native/addon.node", []byte("\x7fELF"), FileOptions{Unpacked: true}),
+		w.AddLink("main.js", "index.js"),
+		w.AddLink("addon", "native/addon.node"),
+		w.AddDir("empty"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteFile(out); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for name, want := range map[string]string{
+		"package.json":      `{"main":"index.js"}`,
+		"index.js":          "console.log(1)",
+		"bin/run":           "#!/bin/sh",
+		"native/addon.node": "\x7fELF",
+		"main.js":           "console.log(1)",
+		"addon":             "\x7fELF",
+	} {
+		if got := readAll(t, a, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	if b, err := os.ReadFile(out + ".unpacked/native/addon.node"); err != nil || string(b) != "\x7fELF" {
+		t.Errorf("unpacked file on disk = %q, %v", b, err)
+	}
+	if e, err := a.Find("native/addon.node"); err != nil || !e.Unpacked {
+		t.Errorf("native/addon.node not marked unpacked: %v", err)
+	}
+	if e, err := a.Find("bin/run"); err != nil || !e.Executable {
+		t.Errorf("bin/run not marked executable: %v", err)
+	}
+	if e, err := a.Find("main.js"); err != nil || e.Link != "index.js" {
+		t.Errorf("main.js is not a link to index.js: %v", err)
+	}
+	if e, err := a.Find("empty"); err != nil || !e.IsDir() || len(e.Files) != 0 {
+		t.Errorf("empty is not an empty directory: %v", err)
+	}
+	if _, err := a.Open("../outside"); err == nil {
+		t.Error("opened a path outside the archive")
+	}
+	if err := a.Verify(); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestIntegrityBlocks(t *testing.T) {
+	data := bytes.Repeat([]byte{'x'}, 2*IntegrityBlockSize+5)
+	w := NewWriter()
+	if err := w.AddBytes("big", data, FileOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ := a.Find("big")
+	if e.Size != int64(len(data)) {
+		t.Errorf("size = %d, want %d", e.Size, len(data))
+	}
+	sum := func(b []byte) string {
+		h := sha256.Sum256(b)
+		return hex.EncodeToString(h[:])
+	}
+	want := Integrity{
+		Algorithm: IntegrityAlgorithm,
+		Hash:      sum(data),
+		BlockSize: IntegrityBlockSize,
+		Blocks: []string{
+			sum(data[:IntegrityBlockSize]),
+			sum(data[IntegrityBlockSize : 2*IntegrityBlockSize]),
+			sum(data[2*IntegrityBlockSize:]),
+		},
+	}
+	got := e.Integrity
+	if got.Algorithm != want.Algorithm || got.Hash != want.Hash || got.BlockSize != want.BlockSize || len(got.Blocks) != len(want.Blocks) {
+		t.Fatalf("integrity = %+v, want %+v", got, want)
+	}
+	for i := range want.Blocks {
+		if got.Blocks[i] != want.Blocks[i] {
+			t.Errorf("block %d = %s, want %s", i, got.Blocks[i], want.Blocks[i])
+		}
+	}
+
+	// Flip a byte of the contents, which follow the header
+	b[len(b)-1] = 'y'
+	a, err = NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Verify(); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("Verify of a tampered archive = %v, want %v", err, ErrIntegrity)
+	}
+}
+
+func TestRejectsOutOfBounds(t *testing.T) {
+	header := func(e *Entry) []byte {
+		b, err := encodeHeader(&Entry{Files: map[string]*Entry{"index.js": e}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(b, "0123456789"...)
+	}
+
+	for name, b := range map[string][]byte{
+		"past the end":     header(&Entry{Offset: 4, Size: 7}),
+		"offset past end":  header(&Entry{Offset: 11, Size: 0}),
+		"overflowing size": header(&Entry{Offset: 1, Size: 1<<63 - 1}),
+		"negative size":    header(&Entry{Size: -1}),
+	} {
+		if _, err := NewReader(bytes.NewReader(b)); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("%s: NewReader = %v, want %v", name, err, ErrInvalidHeader)
+		}
+	}
+
+	if _, err := NewReader(bytes.NewReader(header(&Entry{Offset: 4, Size: 6}))); err != nil {
+		t.Errorf("rejected contents ending at the end of the archive: %v", err)
+	}
+
+	// Truncated on disk
+	w := NewWriter()
+	if err := w.AddBytes("index.js", []byte("console.log(1)"), FileOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "app.asar")
+	if err = os.WriteFile(out, b[:len(b)-1], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Open(out); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Open of a truncated archive = %v, want %v", err, ErrInvalidHeader)
+	}
+}
+
+func TestRejectsBadNames(t *testing.T) {
+	for _, name := range []string{"", ".", "..", "../evil.js", "a/b", `..\evil.js`} {
+		b, err := encodeHeader(&Entry{Files: map[string]*Entry{name: {Size: 0}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewReader(bytes.NewReader(b)); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("%q: NewReader = %v, want %v", name, err, ErrInvalidHeader)
+		}
+	}
+
+	// Below a directory too
+	b, err := encodeHeader(&Entry{Files: map[string]*Entry{"dir": {Files: map[string]*Entry{"..": {Files: map[string]*Entry{}}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReader(bytes.NewReader(b)); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("dir/..: NewReader = %v, want %v", err, ErrInvalidHeader)
+	}
+}
+
+func TestCreateFromDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs symlinks")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for name, data := range map[string]string{
+		"index.js":          "require('./lib/a')",
+		"lib/a.js":          "module.exports = 1",
+		"native/addon.node": "\x7fELF",
+	} {
+		p := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("lib/a.js", filepath.Join(src, "a.js")); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "app.asar")
+	err := CreateFromDir(src, out, func(name string) bool { return filepath.Ext(name) == ".node" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if e, err := a.Find("a.js"); err != nil || e.Link != "lib/a.js" {
+		t.Errorf("a.js is not a link to lib/a.js: %v", err)
+	}
+	if got := readAll(t, a, "a.js"); got != "module.exports = 1" {
+		t.Errorf("a.js = %q", got)
+	}
+	if e, err := a.Find("native/addon.node"); err != nil || !e.Unpacked {
+		t.Errorf("native/addon.node not unpacked: %v", err)
+	}
+	if got := readAll(t, a, "native/addon.node"); got != "\x7fELF" {
+		t.Errorf("native/addon.node = %q", got)
+	}
+	if err = a.Verify(); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	if err = os.Symlink("../outside", filepath.Join(src, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "outside"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = CreateFromDir(src, filepath.Join(dir, "escape.asar"), nil); err == nil {
+		t.Error("packed a link pointing outside of the directory")
+	}
+}
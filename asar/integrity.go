@@ -0,0 +1,91 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package asar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+)
+
+const (
+	IntegrityAlgorithm = "SHA256"
+	IntegrityBlockSize = 4 * 1024 * 1024
+)
+
+var ErrIntegrity = errors.New("asar: integrity check failed")
+
+// integrityWriter hashes everything written to it, both as a whole and in
+// blocks of IntegrityBlockSize, the same way @electron/asar does.
+type integrityWriter struct {
+	whole    hash.Hash
+	block    hash.Hash
+	blockLen int
+	blocks   []string
+	n        int64
+}
+
+func newIntegrityWriter() *integrityWriter {
+	return &integrityWriter{whole: sha256.New(), block: sha256.New()}
+}
+
+func (w *integrityWriter) Write(p []byte) (int, error) {
+	written := len(p)
+	w.n += int64(written)
+	w.whole.Write(p)
+	for len(p) > 0 {
+		chunk := min(len(p), IntegrityBlockSize-w.blockLen)
+		w.block.Write(p[:chunk])
+		w.blockLen += chunk
+		p = p[chunk:]
+		if w.blockLen == IntegrityBlockSize {
+			w.blocks = append(w.blocks, hex.EncodeToString(w.block.Sum(nil)))
+			w.block.Reset()
+			w.blockLen = 0
+		}
+	}
+	return written, nil
+}
+
+func (w *integrityWriter) Integrity() *Integrity {
+	// The trailing block is always emitted, even if empty
+	blocks := append(w.blocks, hex.EncodeToString(w.block.Sum(nil)))
+	return &Integrity{
+		Algorithm: IntegrityAlgorithm,
+		Hash:      hex.EncodeToString(w.whole.Sum(nil)),
+		BlockSize: IntegrityBlockSize,
+		Blocks:    blocks,
+	}
+}
+
+// ComputeIntegrity reads r to the end and returns its integrity block along
+// with the number of bytes read
+func ComputeIntegrity(r io.Reader) (*Integrity, int64, error) {
+	w := newIntegrityWriter()
+	if _, err := io.Copy(w, r); err != nil {
+		return nil, 0, err
+	}
+	return w.Integrity(), w.n, nil
+}
+
+// checkIntegrity compares the integrity of r against want. Only the whole-file hash
+// is compared; the block hashes are derived from the same data.
+func checkIntegrity(r io.Reader, want *Integrity) error {
+	if want.Algorithm != IntegrityAlgorithm {
+		return errors.New("asar: unsupported integrity algorithm " + want.Algorithm)
+	}
+	got, _, err := ComputeIntegrity(r)
+	if err != nil {
+		return err
+	}
+	if got.Hash != want.Hash {
+		return ErrIntegrity
+	}
+	return nil
+}
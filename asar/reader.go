@@ -0,0 +1,264 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package asar
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxHeaderSize guards against allocating absurd amounts of memory when
+// pointed at something that isn't an asar
+const maxHeaderSize = 64 * 1024 * 1024
+
+// maxLinkDepth is how many links Open follows before giving up
+const maxLinkDepth = 32
+
+type Archive struct {
+	Root *Entry
+
+	// Path of the archive on disk, used to locate unpacked entries.
+	// Empty for archives not read via Open
+	Path string
+
+	r      io.ReaderAt
+	closer io.Closer
+	base   int64
+	// Size of r, or -1 when r can't tell
+	size int64
+}
+
+// Open opens the archive at name. Only the header is read into memory.
+func Open(name string) (*Archive, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	a.Path = name
+	a.closer = f
+	return a, nil
+}
+
+// NewReader parses the header of the archive in r
+func NewReader(r io.ReaderAt) (*Archive, error) {
+	var sizePickle [8]byte
+	if _, err := r.ReadAt(sizePickle[:], 0); err != nil {
+		return nil, headerErr(err)
+	}
+	if binary.LittleEndian.Uint32(sizePickle[:4]) != 4 {
+		return nil, ErrInvalidHeader
+	}
+
+	headerSize := binary.LittleEndian.Uint32(sizePickle[4:])
+	if headerSize < 8 || headerSize > maxHeaderSize {
+		return nil, ErrInvalidHeader
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := r.ReadAt(header, 8); err != nil {
+		return nil, headerErr(err)
+	}
+
+	payloadSize := binary.LittleEndian.Uint32(header[:4])
+	jsonSize := binary.LittleEndian.Uint32(header[4:8])
+	if uint64(payloadSize)+4 > uint64(headerSize) || uint64(jsonSize)+4 > uint64(payloadSize) {
+		return nil, ErrInvalidHeader
+	}
+
+	var root Entry
+	if err := json.Unmarshal(header[8:8+jsonSize], &root); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+	if !root.IsDir() {
+		return nil, ErrInvalidHeader
+	}
+	if err := checkNames(&root); err != nil {
+		return nil, err
+	}
+
+	a := &Archive{
+		Root: &root,
+		r:    r,
+		base: 8 + int64(headerSize),
+		size: sizeOf(r),
+	}
+	// Check every entry up front, so that a truncated or forged archive is
+	// rejected here rather than read short later on
+	err := a.Walk(func(name string, e *Entry) error {
+		if e.IsDir() || e.IsLink() || e.Unpacked {
+			return nil
+		}
+		if err := a.checkBounds(e); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// checkNames rejects entry names that would escape their directory or
+// alias another entry once joined into a path
+func checkNames(e *Entry) error {
+	for n, child := range e.Files {
+		if n == "" || n == "." || n == ".." || strings.ContainsAny(n, `/\`) {
+			return fmt.Errorf("%w: bad entry name %q", ErrInvalidHeader, n)
+		}
+		if child == nil {
+			return fmt.Errorf("%w: empty entry %q", ErrInvalidHeader, n)
+		}
+		if err := checkNames(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sizeOf returns the size of r if it can tell, -1 otherwise
+func sizeOf(r io.ReaderAt) int64 {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size()
+	case interface{ Stat() (fs.FileInfo, error) }:
+		if info, err := r.Stat(); err == nil {
+			return info.Size()
+		}
+	}
+	return -1
+}
+
+// checkBounds returns an error if the contents of the packed entry e don't
+// lie within the archive
+func (a *Archive) checkBounds(e *Entry) error {
+	if e.Size < 0 {
+		return fmt.Errorf("%w: negative size", ErrInvalidHeader)
+	}
+	if a.size < 0 {
+		return nil
+	}
+	if avail := a.size - a.base; e.Offset > avail || e.Size > avail-e.Offset {
+		return fmt.Errorf("%w: contents past the end of the archive", ErrInvalidHeader)
+	}
+	return nil
+}
+
+func headerErr(err error) error {
+	if errors.Is(err, io.EOF) {
+		return ErrInvalidHeader
+	}
+	return err
+}
+
+func (a *Archive) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// Find returns the entry at name without following links
+func (a *Archive) Find(name string) (*Entry, error) {
+	return find(a.Root, name)
+}
+
+// resolve is like Find, but follows links
+func (a *Archive) resolve(name string) (*Entry, string, error) {
+	for range maxLinkDepth {
+		e, err := find(a.Root, name)
+		if err != nil {
+			return nil, "", err
+		}
+		if !e.IsLink() {
+			return e, name, nil
+		}
+		name = e.Link
+	}
+	return nil, "", &fs.PathError{Op: "open", Path: name, Err: errors.New("too many links")}
+}
+
+// Open opens the file at name for reading, following links
+func (a *Archive) Open(name string) (io.ReadCloser, error) {
+	e, name, err := a.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if e.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+
+	if e.Unpacked {
+		if a.Path == "" {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("unpacked entry in archive without path")}
+		}
+		return os.Open(a.UnpackedPath(name))
+	}
+
+	if err = a.checkBounds(e); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return io.NopCloser(io.NewSectionReader(a.r, a.base+e.Offset, e.Size)), nil
+}
+
+// ReadFile returns the contents of the file at name
+func (a *Archive) ReadFile(name string) ([]byte, error) {
+	r, err := a.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// UnpackedPath returns where the unpacked entry name is stored on disk
+func (a *Archive) UnpackedPath(name string) string {
+	return filepath.Join(a.Path+".unpacked", filepath.FromSlash(path.Clean("/"+name)))
+}
+
+// Walk calls fn for every entry of the archive in lexical order
+func (a *Archive) Walk(fn WalkFunc) error {
+	err := walk(a.Root, "", fn)
+	if errors.Is(err, fs.SkipDir) {
+		return nil
+	}
+	return err
+}
+
+// Verify checks the contents of every file that has an integrity block
+func (a *Archive) Verify() error {
+	return a.Walk(func(name string, e *Entry) error {
+		if e.IsDir() || e.IsLink() || e.Integrity == nil {
+			return nil
+		}
+
+		r, err := a.Open(name)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		if err = checkIntegrity(r, e.Integrity); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	})
+}
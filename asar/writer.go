@@ -0,0 +1,322 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package asar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type FileOptions struct {
+	Executable bool
+	// Unpacked files are stored in "<archive>.unpacked" instead of the archive
+	Unpacked bool
+}
+
+type source func() (io.ReadCloser, error)
+
+// Writer builds an archive from an arbitrary tree of files
+type Writer struct {
+	root    *Entry
+	sources map[*Entry]source
+}
+
+func NewWriter() *Writer {
+	return &Writer{
+		root:    &Entry{Files: map[string]*Entry{}},
+		sources: map[*Entry]source{},
+	}
+}
+
+func (w *Writer) add(name string, e *Entry) error {
+	parts, err := splitPath(name)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return &fs.PathError{Op: "add", Path: name, Err: fs.ErrInvalid}
+	}
+
+	dir := w.root
+	for _, p := range parts[:len(parts)-1] {
+		child, ok := dir.Files[p]
+		if !ok {
+			child = &Entry{Files: map[string]*Entry{}}
+			dir.Files[p] = child
+		} else if !child.IsDir() {
+			return &fs.PathError{Op: "add", Path: name, Err: errors.New("parent is not a directory")}
+		}
+		dir = child
+	}
+
+	base := parts[len(parts)-1]
+	if existing, ok := dir.Files[base]; ok {
+		// Adding a directory twice is harmless, e.g. when walking a tree
+		if existing.IsDir() && e.IsDir() {
+			return nil
+		}
+		return &fs.PathError{Op: "add", Path: name, Err: fs.ErrExist}
+	}
+	dir.Files[base] = e
+	return nil
+}
+
+// AddDir adds an empty directory. Parents of files are created implicitly.
+func (w *Writer) AddDir(name string) error {
+	return w.add(name, &Entry{Files: map[string]*Entry{}})
+}
+
+func (w *Writer) AddBytes(name string, data []byte, opts FileOptions) error {
+	e := &Entry{Executable: opts.Executable, Unpacked: opts.Unpacked}
+	if err := w.add(name, e); err != nil {
+		return err
+	}
+	w.sources[e] = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil
+}
+
+// AddFile adds the file at src on disk. It is only read once WriteFile is called.
+func (w *Writer) AddFile(name, src string, opts FileOptions) error {
+	e := &Entry{Executable: opts.Executable, Unpacked: opts.Unpacked}
+	if err := w.add(name, e); err != nil {
+		return err
+	}
+	w.sources[e] = func() (io.ReadCloser, error) {
+		return os.Open(src)
+	}
+	return nil
+}
+
+// AddLink adds a symlink. target is relative to the archive root.
+func (w *Writer) AddLink(name, target string) error {
+	if target == "" {
+		return &fs.PathError{Op: "add", Path: name, Err: errors.New("empty link target")}
+	}
+	return w.add(name, &Entry{Link: target})
+}
+
+// WriteFile writes the archive to out and unpacked files to "<out>.unpacked".
+// Files are read twice: once to compute sizes and integrity, once to copy them.
+func (w *Writer) WriteFile(out string) error {
+	header, packed, err := w.layout(out)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("Failed to create %s: %w", out, err)
+	}
+	defer f.Close()
+
+	if err = w.writeTo(f, header, packed); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Bytes returns the archive. It can't have unpacked files, as those are
+// written next to the archive
+func (w *Writer) Bytes() ([]byte, error) {
+	header, packed, err := w.layout("")
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = w.writeTo(&buf, header, packed); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// layout computes the offsets of the packed files, writing the unpacked ones
+// next to out, and returns the header and the packed files in order
+func (w *Writer) layout(out string) ([]byte, []string, error) {
+	var offset int64
+	var packed []string
+
+	err := walk(w.root, "", func(name string, e *Entry) error {
+		if e.IsDir() || e.IsLink() {
+			return nil
+		}
+
+		var err error
+		if e.Unpacked {
+			if out == "" {
+				return errors.New(name + " is unpacked, which needs a file to write the archive to")
+			}
+			err = w.writeUnpacked(out, name, e)
+		} else {
+			err = w.measure(e)
+			e.Offset = offset
+			offset += e.Size
+			packed = append(packed, name)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to read %s: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header, err := encodeHeader(w.root)
+	return header, packed, err
+}
+
+func (w *Writer) writeTo(out io.Writer, header []byte, packed []string) error {
+	if _, err := out.Write(header); err != nil {
+		return fmt.Errorf("Failed to write asar header: %w", err)
+	}
+
+	for _, name := range packed {
+		e, _ := find(w.root, name)
+		if err := w.copyTo(out, e); err != nil {
+			return fmt.Errorf("Failed to write %s to asar: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (w *Writer) measure(e *Entry) error {
+	r, err := w.sources[e]()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	e.Integrity, e.Size, err = ComputeIntegrity(r)
+	return err
+}
+
+func (w *Writer) copyTo(out io.Writer, e *Entry) error {
+	r, err := w.sources[e]()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	n, err := io.Copy(out, r)
+	if err == nil && n != e.Size {
+		err = errors.New("size changed while packing, expected " + strconv.FormatInt(e.Size, 10) + " bytes but got " + strconv.FormatInt(n, 10))
+	}
+	return err
+}
+
+func (w *Writer) writeUnpacked(out, name string, e *Entry) error {
+	r, err := w.sources[e]()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	dst := (&Archive{Path: out}).UnpackedPath(name)
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0644)
+	if e.Executable {
+		mode = 0755
+	}
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	iw := newIntegrityWriter()
+	if _, err = io.Copy(io.MultiWriter(f, iw), r); err != nil {
+		return err
+	}
+	e.Size = iw.n
+	e.Integrity = iw.Integrity()
+	return f.Close()
+}
+
+// encodeHeader serialises root into the two header pickles. The JSON string is
+// padded to a multiple of 4 bytes, as Pickle requires.
+func encodeHeader(root *Entry) ([]byte, error) {
+	j, err := json.Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+
+	aligned := (len(j) + 3) &^ 3
+	buf := make([]byte, 16+aligned)
+	binary.LittleEndian.PutUint32(buf[0:], 4)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(aligned+8))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(aligned+4))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(len(j)))
+	copy(buf[16:], j)
+	return buf, nil
+}
+
+// CreateFromDir packs the directory tree at dir into out, like `asar pack`.
+// unpack may be nil; otherwise files for which it returns true are unpacked.
+func CreateFromDir(dir, out string, unpack func(name string) bool) error {
+	w := NewWriter()
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		switch {
+		case d.IsDir():
+			return w.AddDir(name)
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := filepath.EvalSymlinks(p)
+			if err != nil {
+				return err
+			}
+			absDir, err := filepath.EvalSymlinks(dir)
+			if err != nil {
+				return err
+			}
+			linkRel, err := filepath.Rel(absDir, target)
+			if err != nil {
+				return err
+			}
+			if linkRel == ".." || strings.HasPrefix(linkRel, ".."+string(filepath.Separator)) {
+				return &fs.PathError{Op: "add", Path: name, Err: errors.New("link points outside of " + dir)}
+			}
+			return w.AddLink(name, filepath.ToSlash(linkRel))
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return w.AddFile(name, p, FileOptions{
+				Executable: info.Mode()&0111 != 0,
+				Unpacked:   unpack != nil && unpack(name),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return w.WriteFile(out)
+}
@@ -0,0 +1,353 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	path "path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Every original asar the installer displaces is kept in BaseDir/backups.
+// The files themselves are stored once per content hash in objects/, while
+// index.json records which install, branch and Discord version they came from.
+
+const backupIndexVersion = 1
+
+type Backup struct {
+	ID   string `json:"id"`
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+	// Unpacked is set when app.asar.unpacked was backed up along with the asar
+	Unpacked       bool      `json:"unpacked,omitempty"`
+	InstallPath    string    `json:"installPath"`
+	Branch         string    `json:"branch"`
+	DiscordVersion string    `json:"discordVersion"`
+	Reason         string    `json:"reason"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type backupIndex struct {
+	Version int       `json:"version"`
+	Backups []*Backup `json:"backups"`
+}
+
+func backupDir() string {
+	return path.Join(BaseDir, "backups")
+}
+
+func backupObjectPath(hash string) string {
+	return path.Join(backupDir(), "objects", hash+".asar")
+}
+
+func readBackupIndex() (*backupIndex, error) {
+	index := &backupIndex{Version: backupIndexVersion}
+
+	b, err := FS.ReadFile(path.Join(backupDir(), "index.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return index, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(b, index); err != nil {
+		return nil, fmt.Errorf("Failed to parse backup index: %w", err)
+	}
+	return index, nil
+}
+
+func (index *backupIndex) save() error {
+	b, err := json.MarshalIndent(index, "", "\t")
+	if err != nil {
+		return err
+	}
+	return FS.WriteFile(path.Join(backupDir(), "index.json"), b, 0644)
+}
+
+func backupID(b *Backup) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{b.Hash, b.InstallPath, b.Branch, b.DiscordVersion}, "\x00")))
+	return hex.EncodeToString(sum[:])[:10]
+}
+
+// ListBackups returns all backups, newest first
+func ListBackups() ([]*Backup, error) {
+	index, err := readBackupIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	backups := index.Backups
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// FindBackup returns the backup whose id starts with id
+func FindBackup(id string) (*Backup, error) {
+	backups, err := ListBackups()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Backup
+	for _, b := range backups {
+		if strings.HasPrefix(b.ID, strings.ToLower(id)) {
+			if found != nil {
+				return nil, errors.New("Backup id " + id + " is ambiguous")
+			}
+			found = b
+		}
+	}
+	if found == nil {
+		return nil, errors.New("No backup with id " + id)
+	}
+	return found, nil
+}
+
+// BackupAsar copies asarFile of di, and app.asar.unpacked next to it if any,
+// into the backup store, unless an identical backup for the same install and
+// Discord version already exists. Contents already in the store aren't copied
+// again
+func (di *DiscordInstall) BackupAsar(asarFile, reason string) (*Backup, error) {
+	hash, size, err := hashBackupSource(asarFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to back up %s: %w", asarFile, err)
+	}
+	unpacked := asarFile + ".unpacked"
+
+	b := &Backup{
+		Hash:           hash,
+		Size:           size,
+		Unpacked:       ExistsFile(unpacked),
+		InstallPath:    di.path,
+		Branch:         di.branch,
+		DiscordVersion: di.DiscordVersion(),
+		Reason:         reason,
+		CreatedAt:      time.Now(),
+	}
+	b.ID = backupID(b)
+
+	index, err := readBackupIndex()
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range index.Backups {
+		if existing.ID == b.ID && existing.Unpacked == b.Unpacked && ExistsFile(backupObjectPath(existing.Hash)) {
+			Log.Debug(asarFile, "is already backed up as", existing.ID)
+			return existing, nil
+		}
+	}
+
+	if err = FS.MkdirAll(path.Join(backupDir(), "objects"), 0755); err != nil {
+		return nil, err
+	}
+	if !ExistsFile(backupObjectPath(b.Hash)) {
+		if err = storeBackupObject(asarFile, b.Hash); err != nil {
+			return nil, fmt.Errorf("Failed to back up %s: %w", asarFile, err)
+		}
+	}
+	if b.Unpacked && !ExistsFile(backupObjectPath(b.Hash)+".unpacked") {
+		if err = storeBackupUnpacked(unpacked, b.Hash); err != nil {
+			return nil, fmt.Errorf("Failed to back up %s: %w", unpacked, err)
+		}
+	}
+
+	index.Backups = append(SliceFilter(index.Backups, func(e *Backup) bool { return e.ID != b.ID }), b)
+	if err = index.save(); err != nil {
+		return nil, fmt.Errorf("Failed to save backup index: %w", err)
+	}
+	_ = FixOwnership(backupDir())
+
+	Log.Info("Backed up", asarFile, "as", b.ID)
+	return b, nil
+}
+
+// hashBackupSource returns the sha256 and size of name
+func hashBackupSource(name string) (string, int64, error) {
+	f, err := FS.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// storeBackupObject copies src into the store as the object hash. src is
+// hashed again while copying, in case it changed since it was first hashed
+func storeBackupObject(src, hash string) error {
+	in, err := FS.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := FS.CreateTemp(path.Join(backupDir(), "objects"), ".backup-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer FS.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tmp, h), in); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		return errors.New(src + " changed while it was being backed up")
+	}
+	return FS.Rename(tmp.Name(), backupObjectPath(hash))
+}
+
+// storeBackupUnpacked copies the app.asar.unpacked directory src into the
+// store, next to the object hash of the app.asar it belongs to
+func storeBackupUnpacked(src, hash string) error {
+	dest := backupObjectPath(hash) + ".unpacked"
+	// The store is ours, so whatever a failed run left there can go
+	tmp := dest + ".tmp"
+	if err := FS.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := copyDir(src, tmp); err != nil {
+		_ = FS.RemoveAll(tmp)
+		return err
+	}
+	return FS.Rename(tmp, dest)
+}
+
+// backupBeforeReplacing backs up asarFile, warning instead of failing since
+// the installer keeps its own _app.asar / app.asar.backup copy anyway
+func (di *DiscordInstall) backupBeforeReplacing(asarFile, reason string) {
+	if _, err := di.BackupAsar(asarFile, reason); err != nil {
+		Log.Warn("Failed to back up", asarFile+":", err)
+	}
+}
+
+// LatestBackup returns the newest backup of di, preferring ones taken from the
+// same Discord version. Backups taken by RestoreBackup are skipped, as those
+// are whatever was in place before, not necessarily an original asar
+func (di *DiscordInstall) LatestBackup() *Backup {
+	backups, err := ListBackups()
+	if err != nil {
+		Log.Warn("Failed to read backups:", err)
+		return nil
+	}
+
+	version := di.DiscordVersion()
+	var fallback *Backup
+	for _, b := range backups {
+		if b.InstallPath != di.path || b.Reason == "restore" || !ExistsFile(backupObjectPath(b.Hash)) {
+			continue
+		}
+		if b.DiscordVersion == version {
+			return b
+		}
+		if fallback == nil {
+			fallback = b
+		}
+	}
+	return fallback
+}
+
+// RestoreBackup puts the original asar from b back in place, with its
+// app.asar.unpacked if it had one. Patched installs get it restored as
+// _app.asar, so they stay patched.
+func (di *DiscordInstall) RestoreBackup(b *Backup) error {
+	PreparePatch(di)
+
+	// Whether the install is patched, and so where the asar goes, is only
+	// known once an interrupted patch or unpatch is sorted out
+	if _, err := di.recoverPendingJournal(); err != nil {
+		return err
+	}
+
+	src, err := FS.Open(backupObjectPath(b.Hash))
+	if err != nil {
+		return fmt.Errorf("Backup %s is gone: %w", b.ID, err)
+	}
+	defer src.Close()
+
+	dir := di.patchDir()
+	target := path.Join(dir, Ternary(di.isPatched, "_app.asar", "app.asar"))
+	Log.Info("Restoring backup", b.ID, "to", target)
+
+	if ExistsFile(target) {
+		di.backupBeforeReplacing(target, "restore")
+	}
+
+	tmp, err := FS.CreateTemp(dir, ".app.asar.*.tmp")
+	if err != nil {
+		return err
+	}
+	defer FS.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err = io.Copy(tmp, src); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = FS.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if b.Unpacked {
+		if err = restoreBackupUnpacked(b, target, tmp.Name()+".unpacked"); err != nil {
+			return err
+		}
+	}
+	if err = FS.Rename(tmp.Name(), target); err != nil {
+		return CheckIfErrIsCauseItsBusyRn(err)
+	}
+
+	di.isOpenAsar = nil
+	return nil
+}
+
+// restoreBackupUnpacked replaces target.unpacked with the one backed up with
+// b, staging it in tmp, a path no one else uses
+func restoreBackupUnpacked(b *Backup, target, tmp string) error {
+	if err := copyDir(backupObjectPath(b.Hash)+".unpacked", tmp); err != nil {
+		_ = FS.RemoveAll(tmp)
+		return fmt.Errorf("Failed to restore the unpacked files of backup %s: %w", b.ID, err)
+	}
+
+	unpacked := target + ".unpacked"
+	old := tmp + ".old"
+	if ExistsFile(unpacked) {
+		if err := FS.Rename(unpacked, old); err != nil {
+			_ = FS.RemoveAll(tmp)
+			return CheckIfErrIsCauseItsBusyRn(err)
+		}
+	}
+	if err := FS.Rename(tmp, unpacked); err != nil {
+		_ = FS.Rename(old, unpacked)
+		_ = FS.RemoveAll(tmp)
+		return CheckIfErrIsCauseItsBusyRn(err)
+	}
+	if err := FS.RemoveAll(old); err != nil {
+		Log.Warn("Failed to delete", old+":", err)
+	}
+	return nil
+}
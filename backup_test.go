@@ -0,0 +1,104 @@
+//go:build linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"errors"
+	path "path/filepath"
+	"testing"
+)
+
+// noTempFS fails every CreateTemp, which BackupAsar only needs to copy
+// contents that aren't in the store yet
+type noTempFS struct {
+	FileSystem
+}
+
+func (noTempFS) CreateTemp(dir, _ string) (WritableFile, error) {
+	return nil, errors.New("copied " + dir + " again")
+}
+
+func TestBackupAsarStoresContentsOnce(t *testing.T) {
+	fx := newFixture(t)
+	a := fx.parse(fx.Normal("/opt/discord"))
+	b := fx.parse(fx.Normal("/opt/discord-copy"))
+	// Same contents as /opt/discord
+	fx.must(fx.fs.WriteFile(path.Join(b.patchDir(), "app.asar"), fx.read(path.Join(a.patchDir(), "app.asar")), 0644))
+
+	first, err := a.BackupAsar(path.Join(a.patchDir(), "app.asar"), "patch")
+	fx.must(err)
+
+	FS = noTempFS{fx.fs}
+	second, err := b.BackupAsar(path.Join(b.patchDir(), "app.asar"), "patch")
+	fx.must(err)
+	if first.Hash != second.Hash || first.ID == second.ID {
+		t.Errorf("backups of two installs with the same asar: %+v and %+v", first, second)
+	}
+	again, err := a.BackupAsar(path.Join(a.patchDir(), "app.asar"), "patch")
+	fx.must(err)
+	if again.ID != first.ID {
+		t.Errorf("backing up again made a new backup %s, want %s", again.ID, first.ID)
+	}
+
+	backups, err := ListBackups()
+	fx.must(err)
+	if len(backups) != 2 {
+		t.Errorf("%d backups, want 2", len(backups))
+	}
+}
+
+func TestRestoreBackupUnpacked(t *testing.T) {
+	fx := newFixture(t)
+	di := fx.parse(fx.SystemElectron("/usr/lib/discord"))
+	dir := di.patchDir()
+	original := fx.read(path.Join(dir, "app.asar"))
+
+	fx.must(di.patch())
+	backup := di.LatestBackup()
+	if backup == nil || !backup.Unpacked {
+		t.Fatalf("patch backed up %+v, want app.asar.unpacked too", backup)
+	}
+
+	// A broken update of the package
+	fx.must(fx.fs.WriteFile(path.Join(dir, "_app.asar"), []byte("broken"), 0644))
+	fx.must(fx.fs.RemoveAll(path.Join(dir, "_app.asar.unpacked")))
+
+	fx.must(di.RestoreBackup(backup))
+	fx.assertAsar(path.Join(dir, "_app.asar"), original)
+	if got := string(fx.read(path.Join(dir, "_app.asar.unpacked", "discord_native.node"))); got != "native" {
+		t.Errorf("restored discord_native.node = %q", got)
+	}
+	fx.assertStub(path.Join(dir, "app.asar"), fixtureBashcord)
+}
+
+func TestRestoreBackupRecoversJournal(t *testing.T) {
+	fx := newFixture(t)
+	di := fx.parse(fx.Normal("/opt/discord"))
+	dir := di.patchDir()
+	original := fx.read(path.Join(dir, "app.asar"))
+	fx.must(di.patch())
+	backup := di.LatestBackup()
+
+	// An unpatch stopped halfway, with app.asar moved away
+	fx.inject(dir, &faultFS{failRenames: map[int]bool{2: true, 3: true}})
+	if err := di.unpatch(); !errors.Is(err, errInjected) {
+		t.Fatalf("unpatch() = %v, want the injected failure", err)
+	}
+	FS = fx.fs
+	di = fx.parse(di.path)
+	attachPendingJournals([]any{di})
+
+	fx.must(di.RestoreBackup(backup))
+	fx.assertExists(journalPath(dir), false)
+	if di.isPatched {
+		t.Error("patched after restoring over an interrupted unpatch")
+	}
+	fx.assertAsar(path.Join(dir, "app.asar"), original)
+	fx.assertExists(path.Join(dir, "_app.asar"), false)
+}
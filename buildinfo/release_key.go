@@ -0,0 +1,7 @@
+package buildinfo
+
+// ReleasePublicKey is the minisign public key (or a base64 raw ed25519 key)
+// the SHA256SUMS of Bashcord releases must be signed with. It is set at build
+// time with -X 'vencord/buildinfo.ReleasePublicKey=RW...'. If empty, nothing
+// is installed unless BASHCORD_INSECURE_SKIP_VERIFY is set.
+var ReleasePublicKey = ""
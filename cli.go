@@ -15,15 +15,33 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"text/tabwriter"
+	"time"
 	"vencord/buildinfo"
 
 	"github.com/fatih/color"
 	"github.com/manifoldco/promptui"
+	"github.com/mattn/go-isatty"
 )
 
 var discords []any
 var interactive = false
 
+// killDiscord is --kill, promptKill whether to ask instead when it isn't given
+var killDiscord, promptKill bool
+
+// relaunchDiscord is whether Discord is started again after closing it, see --no-relaunch
+var relaunchDiscord = true
+
+// launchDiscord is --launch
+var launchDiscord bool
+
+// overrideReadOnly is --override
+var overrideReadOnly bool
+
+// copyTo is --copy-to
+var copyTo string
+
 func showBanner() {
 	color.HiRed(`                                                                                                    
                                            :::::::::::::                                            
@@ -80,6 +98,10 @@ func isValidBranch(branch string) bool {
 }
 
 func die(msg string) {
+	if result.ErrorCode == "" {
+		result.ErrorCode = ErrCodeUsage
+		result.Error = msg
+	}
 	Log.Error(msg)
 	exitFailure()
 }
@@ -89,15 +111,30 @@ func main() {
 	if runtime.GOOS == "windows" {
 		ResizeConsoleWindow()
 	}
-	
-	InitGithubDownloader()
-	discords = FindDiscords()
+
+	// asar tooling doesn't need Discord or GitHub, so handle it before anything else
+	if len(os.Args) > 1 && os.Args[1] == "asar" {
+		asarMain(os.Args[2:])
+	}
+	// status is the same as --list
+	if len(os.Args) > 1 && os.Args[1] == "status" {
+		os.Args = Prepend(os.Args[2:], os.Args[0], "--list")
+	}
+
+	// apply has its own flags, see cli_apply.go
+	if len(os.Args) > 1 && os.Args[1] == "apply" {
+		applyMain(os.Args[2:])
+	}
 
 	// Used by log.go init func
 	flag.Bool("debug", false, "Activer les infos de debug (pour les masochistes)")
+	flag.StringVar(&channelArg, "channel", "", "Le canal de BASHCORD à installer, retenu pour la prochaine fois ["+strings.Join(ChannelNames(), "|")+"]")
+	flag.StringVar(&releaseSourceArg, "release-source", "", "D'où télécharger Bashcord : owner/repo[@tag], une url https vers un miroir ou file:///un/dossier")
+	flag.IntVar(&searchDepthArg, "search-depth", 0, "Chercher Discord jusqu'à cette profondeur dans les dossiers de recherche, 1 par défaut (Linux, voir aussi BASHCORD_SEARCH_PATHS)")
 
 	var helpFlag = flag.Bool("help", false, "Afficher les instructions d'usage (si tu sais pas lire)")
-	var versionFlag = flag.Bool("version", false, "Voir la version du programme (passionnant)")
+	var versionFlag releaseVersionFlag
+	flag.Var(&versionFlag, "version", "Voir la version du programme (passionnant), ou avec --version <tag|hash>, installer cette version de BASHCORD")
 	var updateSelfFlag = flag.Bool("update-self", false, "Me mettre à jour (j'en ai besoin)")
 	var installFlag = flag.Bool("install", false, "Installer BASHCORD (enfin !)")
 	var updateFlag = flag.Bool("repair", false, "Réparer BASHCORD (encore cassé ?)")
@@ -105,49 +142,238 @@ func main() {
 	var installOpenAsarFlag = flag.Bool("install-openasar", false, "Installer OpenAsar (pour les vrais)")
 	var uninstallOpenAsarFlag = flag.Bool("uninstall-openasar", false, "Désinstaller OpenAsar (retour aux basiques)")
 	var locationFlag = flag.String("location", "", "L'emplacement de Discord à modifier")
-	var branchFlag = flag.String("branch", "", "La branche Discord à modifier [auto|stable|ptb|canary]")
-	flag.Parse()
+	var branchesFlag branchList
+	flag.Var(&branchesFlag, "branch", "La branche Discord à modifier [auto|stable|ptb|canary], répète-le pour en modifier plusieurs")
+	var allFlag = flag.Bool("all", false, "Modifier toutes les installations Discord trouvées (stable, canary et compagnie d'un coup)")
+	var listFlag = flag.Bool("list", false, "Lister les installations Discord trouvées et leur état (aussi : la commande status)")
+	var listBackupsFlag = flag.Bool("list-backups", false, "Lister les sauvegardes des app.asar d'origine")
+	var restoreFlag = flag.String("restore", "", "Restaurer la sauvegarde avec cet id (voir --list-backups)")
+	var fromFileFlag = flag.String("from-file", "", "Installer BASHCORD depuis ce desktop.asar au lieu de le télécharger, avec le SHA256SUMS signé de sa release à côté (pas d'internet, pas de problème)")
+	var fromBundleFlag = flag.String("from-bundle", "", "Installer BASHCORD depuis ce zip (desktop.asar + SHA256SUMS) au lieu de le télécharger")
+	var listReleasesFlag = flag.Bool("list-releases", false, "Lister les versions de BASHCORD disponibles")
+	var rollbackFlag = flag.Bool("rollback", false, "Revenir à la version de BASHCORD installée avant (la nouvelle est cassée, hein ?)")
+	var watchFlag = flag.Bool("watch", false, "Rester en fond et repatcher Discord à chaque fois qu'il se met à jour (il adore casser le patch)")
+	var installServiceFlag = flag.Bool("install-service", false, "Installer --watch comme service systemd utilisateur (Linux uniquement, sans les installations où tu ne peux pas écrire, comme /opt/discord)")
+	var dryRunFlag = flag.Bool("dry-run", false, "Afficher ce qui serait fait (renommages, écritures, commandes) sans rien toucher")
+	flag.BoolVar(&killDiscord, "kill", false, "Fermer Discord sans demander s'il tourne pendant qu'on le modifie (Linux, Windows le ferme d'office)")
+	var noRelaunchFlag = flag.Bool("no-relaunch", false, "Ne pas relancer Discord après l'avoir fermé (il t'a saoulé)")
+	flag.BoolVar(&launchDiscord, "launch", false, "Lancer Discord une fois patché (même s'il ne tournait pas, quel service)")
+	flag.BoolVar(&overrideReadOnly, "override", false, "Discord snap ou Nix est en lecture seule : patcher une copie modifiable dans ~/.local/share à la place (l'original reste intact)")
+	flag.StringVar(&copyTo, "copy-to", "", "Patcher une copie de Discord dans ce dossier, avec un lanceur et une entrée de menu, au lieu de l'original (Linux)")
+	var nixOverlayFlag = flag.Bool("nix-overlay", false, "Écrire un overlay nixpkgs qui patche le paquet Discord de Nix (pour ceux qui rebuildent tout)")
+	var recoverFlag = flag.String("recover", "", "Que faire d'un patch interrompu (crash, coupure de courant...) [auto|forward|back]")
+	var jsonFlag = flag.Bool("json", false, "Afficher le résultat en JSON sur stdout et les logs en lignes JSON sur stderr (pour les scripts, pas pour les humains)")
+	var outputFlag = flag.String("output", "text", "Le format de sortie [text|json], --output json revient à --json")
+	_ = flag.CommandLine.Parse(joinVersionArg(os.Args[1:]))
+
+	LogJSON = *jsonFlag || *outputFlag == "json"
+	setupJSONOutput()
+	versionArg = versionFlag.release
+	offlineArg = *fromFileFlag + *fromBundleFlag
+
+	InitGithubDownloader()
+	discords = FindDiscords()
 
 	if *helpFlag {
 		flag.Usage()
 		return
 	}
 
-	if *versionFlag {
+	if versionFlag.set && versionFlag.release == "" {
+		if LogJSON {
+			result.Action = "version"
+			result.Data = map[string]string{"tag": buildinfo.InstallerTag, "gitHash": buildinfo.InstallerGitHash}
+			exit(0)
+		}
 		fmt.Println("Equilotl Cli", buildinfo.InstallerTag, "("+buildinfo.InstallerGitHash+")")
 		fmt.Println("Copyright (C) 2025 Vendicated et les contributeurs Vencord")
 		fmt.Println("Licence GPLv3+ : GNU GPL version 3 ou plus récente <https://gnu.org/licenses/gpl.html>.")
 		return
 	}
 
+	relaunchDiscord = !*noRelaunchFlag
+	// Nobody is there to answer in json mode or in the background
+	promptKill = !LogJSON && !*watchFlag && (isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd()))
+
+	if *outputFlag != "text" && *outputFlag != "json" {
+		die("Le flag 'output' doit être l'un des suivants : [text|json] (pas de XML, désolé)")
+	}
+
+	if *dryRunFlag {
+		if *updateSelfFlag || *watchFlag {
+			die("Le flag 'dry-run' ne marche pas avec 'update-self' ou 'watch' (fais-moi confiance, pour une fois).")
+		}
+		dryRun = StartDryRun()
+	}
+
 	if *updateSelfFlag {
+		result.Action = "update-self"
 		if !<-SelfUpdateCheckDoneChan {
-			die("Impossible de me mettre à jour car la vérification des mises à jour a échoué (bravo)")
+			dieCode(ErrCodeReleaseFetch, "Impossible de me mettre à jour car la vérification des mises à jour a échoué (bravo)")
 		}
 		if err := UpdateSelf(); err != nil {
 			Log.Error("Échec de la mise à jour automatique :", err)
-			exitFailure()
+			exitError(err)
 		}
 		exitSuccess()
 	}
 
-	if *locationFlag != "" && *branchFlag != "" {
+	branches := []string(branchesFlag)
+	if *locationFlag != "" && len(branches) != 0 {
 		die("Les flags 'location' et 'branch' sont mutuellement exclusifs (choisis-en un, génie).")
 	}
+	if *allFlag && (*locationFlag != "" || len(branches) != 0) {
+		die("Le flag 'all' ne se combine pas avec 'location' ou 'branch' (tout, c'est tout).")
+	}
 
-	if !isValidBranch(*branchFlag) {
-		die("Le flag 'branch' doit être l'un des suivants : [auto|stable|ptb|canary] (pas si compliqué)")
+	for _, b := range branches {
+		if !isValidBranch(b) {
+			die("Le flag 'branch' doit être l'un des suivants : [auto|stable|ptb|canary] (pas si compliqué)")
+		}
+	}
+	// With --all or several --branch, the action is done on all of them
+	multiple := *allFlag || len(branches) > 1
+	branch := ""
+	if len(branches) == 1 {
+		branch = branches[0]
 	}
 
-	if *installFlag || *updateFlag {
-		if !<-GithubDoneChan {
-			die("Pas d'" + Ternary(*installFlag, "installation", "mise à jour") + " car la récupération des données de release a échoué (GitHub nous boude)")
+	if channelArg != "" {
+		if err := SaveChannel(channelArg); err != nil {
+			die("Le flag 'channel' doit être l'un des suivants : [" + strings.Join(ChannelNames(), "|") + "] (tu l'as inventé ?)")
 		}
+		Log.Info("Canal " + channelArg + " retenu pour les prochaines fois")
+	}
+
+	if !isValidRecoverMode(*recoverFlag) {
+		die("Le flag 'recover' doit être l'un des suivants : [auto|forward|back] (lis l'aide, pour une fois)")
+	}
+
+	if *fromFileFlag != "" && *fromBundleFlag != "" {
+		die("Les flags 'from-file' et 'from-bundle' sont mutuellement exclusifs (un seul fichier suffit).")
+	}
+	offlineFile := *fromFileFlag + *fromBundleFlag
+	if offlineFile != "" && (*uninstallFlag || *installOpenAsarFlag || *uninstallOpenAsarFlag) {
+		die("Les flags 'from-file' et 'from-bundle' ne servent qu'à installer ou réparer (réfléchis deux secondes).")
+	}
+	if copyTo != "" && (*uninstallFlag || *installOpenAsarFlag || *uninstallOpenAsarFlag) {
+		die("Le flag 'copy-to' ne sert qu'à installer ou réparer (une copie dépatchée, c'est juste une copie).")
+	}
+	if copyTo != "" && multiple {
+		die("Le flag 'copy-to' copie une seule installation à la fois (une seule branche, merci).")
+	}
+
+	if multiple && *restoreFlag != "" {
+		die("Le flag 'restore' ne restaure qu'une installation à la fois (une seule branche, merci).")
+	}
+
+	if versionFlag.release != "" && (offlineFile != "" || *rollbackFlag) {
+		die("Le flag 'version' ne se combine pas avec 'from-file', 'from-bundle' ou 'rollback' (choisis ta version, une seule).")
 	}
 
 	install, uninstall, update, installOpenAsar, uninstallOpenAsar := *installFlag, *uninstallFlag, *updateFlag, *installOpenAsarFlag, *uninstallOpenAsarFlag
+	// An offline file, a version or a copy is pointless without installing it
+	install = install || ((offlineFile != "" || versionFlag.release != "" || copyTo != "") && !update)
 	switches := []*bool{&install, &update, &uninstall, &installOpenAsar, &uninstallOpenAsar}
-	if !SliceContainsFunc(switches, func(b *bool) bool { return *b }) {
+	hasAction := SliceContainsFunc(switches, func(b *bool) bool { return *b })
+
+	for _, discord := range discords {
+		if di := discord.(*DiscordInstall); di.journal != nil {
+			recoverInterrupted(di, *recoverFlag, !hasAction && *recoverFlag == "" && !LogJSON)
+		}
+	}
+	if *recoverFlag != "" && !hasAction {
+		result.Action = "recover"
+		exitSuccess()
+	}
+
+	if *installServiceFlag {
+		result.Action = "install-service"
+		if err := installService(); err != nil {
+			Log.Error(err)
+			exitError(err)
+		}
+		exitSuccess()
+	}
+
+	if *watchFlag {
+		result.Action = "watch"
+		if err := watchMain(); err != nil {
+			Log.Error("La surveillance a planté :", err)
+			exitError(err)
+		}
+		exit(0)
+	}
+
+	if *listFlag {
+		result.Action = "list"
+		listInstalls()
+		exit(0)
+	}
+
+	if *listBackupsFlag {
+		result.Action = "list-backups"
+		listBackups()
+		exit(0)
+	}
+
+	if *restoreFlag != "" {
+		result.Action = "restore"
+		if err := restoreBackup(*restoreFlag, *locationFlag, branch); err != nil {
+			Log.Error(err)
+			exitError(err)
+		}
+		relaunch(result.discord, false)
+		exitSuccess()
+	}
+
+	if *nixOverlayFlag {
+		result.Action = "nix-overlay"
+		result.discord = PromptDiscord("patcher", *locationFlag, branch)
+		overlay, err := WriteNixOverlay(result.discord)
+		if err != nil {
+			Log.Error(err)
+			exitError(err)
+		}
+		result.Data = map[string]string{"overlay": overlay}
+		if !LogJSON {
+			fmt.Println("Overlay écrit dans", overlay+", les instructions sont dedans.")
+			fmt.Println("Ajoute-le à tes overlays et rebuild (tu connais la chanson).")
+		}
+		exitSuccess()
+	}
+
+	if *listReleasesFlag {
+		result.Action = "list-releases"
+		listReleases()
+		exit(0)
+	}
+
+	if *rollbackFlag {
+		result.Action = "rollback"
+		if err := RollbackBuild(); err != nil {
+			Log.Error(err)
+			exitError(err)
+		}
+		exitSuccess()
+	}
+
+	result.Action = actionName(install, update, uninstall, installOpenAsar, uninstallOpenAsar)
+	if offlineFile != "" {
+		if err := Ternary(*fromBundleFlag != "", InstallFromBundle, InstallFromFile)(offlineFile); err != nil {
+			Log.Error(err)
+			exitError(err)
+		}
+	} else if install || update {
+		if !<-GithubDoneChan {
+			dieCode(ErrCodeReleaseFetch, "Pas d'" + Ternary(install, "installation", "mise à jour") + " car la récupération des données de release a échoué (GitHub nous boude) : " + GithubError.Error())
+		}
+	}
+
+	if !hasAction {
+		if LogJSON {
+			die("--json a besoin d'une action (--install, --repair, --uninstall...), je ne pose pas de questions aux scripts")
+		}
 		interactive = true
 
 		// Afficher le banner ASCII seulement en mode interactif
@@ -187,55 +413,415 @@ func main() {
 		case "Mettre à jour Equilotl (fais-le !)":
 			if err := UpdateSelf(); err != nil {
 				Log.Error("Échec de la mise à jour automatique :", err)
-				exitFailure()
+				exitError(err)
 			}
 			exitSuccess()
 		}
 
 		*switches[SliceIndex(choices, choice)] = true
+		result.Action = actionName(install, update, uninstall, installOpenAsar, uninstallOpenAsar)
 	}
 
-	var err error
-	var errSilent error
-	if install {
-		errSilent = PromptDiscord("patcher", *locationFlag, *branchFlag).patch()
-	} else if uninstall {
-		errSilent = PromptDiscord("dépatcher", *locationFlag, *branchFlag).unpatch()
-	} else if update {
+	if update && offlineFile == "" {
 		Log.Info("Téléchargement des derniers fichiers Bashcord... (patience, petit scarabée)")
-		err := installLatestBuilds()
+		if err := installLatestBuilds(); err != nil {
+			exitError(err)
+		}
 		Log.Info("Terminé ! (miracle)")
+	}
+
+	// Only here, --restore goes by the backup and --nix-overlay by what is asked
+	if branch == "" && *locationFlag == "" && !multiple {
+		branch = configBranch()
+	}
+
+	verb := Ternary(uninstall, "dépatcher", Ternary(update, "réparer", "patcher"))
+	if multiple {
+		runOnAll(result.Action, selectInstalls(verb, *allFlag, branches))
+	}
+
+	result.discord = PromptDiscord(verb, *locationFlag, branch)
+	di, err := patchTarget(result.Action, result.discord)
+	if err != nil {
+		exitError(err)
+	}
+	result.discord = di
+	if err = doAction(result.Action, di); err != nil {
+		exitError(err)
+	}
+	exitSuccess()
+}
+
+// configBranch returns the preferred branch saved in the preferences, if any
+func configBranch() string {
+	config, err := ReadConfig()
+	if err != nil {
+		Log.Warn("Impossible de lire les préférences :", err)
+		return ""
+	}
+	if config.Branch != "" && !isValidBranch(config.Branch) {
+		Log.Warn("Branche préférée " + config.Branch + " invalide, je l'ignore")
+		return ""
+	}
+	if config.Branch != "" {
+		Log.Debug("Using preferred branch", config.Branch)
+	}
+	return config.Branch
+}
+
+// doAction does action on di. The error is logged already
+func doAction(action string, di *DiscordInstall) (err error) {
+	defer func() {
 		if err == nil {
-			errSilent = PromptDiscord("réparer", *locationFlag, *branchFlag).patch()
+			relaunch(di, action == "install" || action == "repair")
+		}
+	}()
+
+	if err = di.checkWritable(); err != nil {
+		Log.Error(err)
+		if action == "install" || action == "repair" {
+			Log.Error("Relance avec --override pour patcher une copie modifiable à la place (l'original, on n'y touche pas, promis)")
+			if di.isNix {
+				Log.Error("Ou avec --nix-overlay pour patcher le paquet lui-même au prochain rebuild")
+			}
 		}
-	} else if installOpenAsar {
-		discord := PromptDiscord("patcher", *locationFlag, *branchFlag)
-		if !discord.IsOpenAsar() {
-			err = discord.InstallOpenAsar()
+		return err
+	}
+
+	switch action {
+	case "install", "repair":
+		return di.patch()
+	case "uninstall":
+		return di.unpatch()
+	case "install-openasar":
+		if di.IsOpenAsar() {
+			err = &codeError{ErrCodeNothingToDo, "OpenAsar déjà installé (tu dors ou quoi ?)"}
 		} else {
-			die("OpenAsar déjà installé (tu dors ou quoi ?)")
+			err = di.InstallOpenAsar()
 		}
-	} else if uninstallOpenAsar {
-		discord := PromptDiscord("patcher", *locationFlag, *branchFlag)
-		if discord.IsOpenAsar() {
-			err = discord.UninstallOpenAsar()
+	case "uninstall-openasar":
+		if !di.IsOpenAsar() {
+			err = &codeError{ErrCodeNothingToDo, "OpenAsar pas installé (logique, non ?)"}
 		} else {
-			die("OpenAsar pas installé (logique, non ?)")
+			err = di.UninstallOpenAsar()
 		}
 	}
-
 	if err != nil {
 		Log.Error(err)
-		exitFailure()
 	}
-	if errSilent != nil {
-		exitFailure()
+	return err
+}
+
+// patchTarget swaps di for a copy of it with --copy-to, or with
+// --override when di is read-only, if we are to patch it. doAction then
+// patches the copy
+func patchTarget(action string, di *DiscordInstall) (*DiscordInstall, error) {
+	if action != "install" && action != "repair" {
+		return di, nil
 	}
+	var copied *DiscordInstall
+	var err error
+	switch {
+	case copyTo != "":
+		copied, err = PortableCopy(di, copyTo)
+	case overrideReadOnly && di.readOnly():
+		copied, err = CopyReadOnly(di)
+	default:
+		return di, nil
+	}
+	if err != nil {
+		Log.Error("Impossible de copier", di.path, ":", err)
+		return di, err
+	}
+	return copied, nil
+}
 
-	exitSuccess()
+// selectInstalls returns the installs to work on with --all or several --branch
+func selectInstalls(verb string, all bool, branches []string) []*DiscordInstall {
+	if all {
+		if len(discords) == 0 {
+			dieCode(ErrCodeNotFound, "Aucune installation Discord trouvée, tout faire sur rien c'est vite fait.")
+		}
+		return SliceMap(discords, func(d any) *DiscordInstall {
+			return d.(*DiscordInstall)
+		})
+	}
+
+	var installs []*DiscordInstall
+	for _, b := range branches {
+		// auto may pick one that was given explicitly
+		if di := PromptDiscord(verb, "", b); !SliceContains(installs, di) {
+			installs = append(installs, di)
+		}
+	}
+	return installs
 }
 
+// runOnAll does action on every install, carrying on when one fails, then exits
+func runOnAll(action string, installs []*DiscordInstall) {
+	var codes []string
+	for _, di := range installs {
+		Log.Info("→", di.branch, "("+di.path+")")
+		di, err := patchTarget(action, di)
+		if err == nil {
+			err = doAction(action, di)
+		}
+		r := &InstallResult{InstallStatus: statusOf(di), Success: err == nil}
+		if err != nil {
+			r.ErrorCode, r.Error = errorCode(err), err.Error()
+			codes = append(codes, r.ErrorCode)
+		}
+		result.Installs = append(result.Installs, r)
+	}
+
+	if !LogJSON {
+		fmt.Println()
+		for _, r := range result.Installs {
+			if r.Success {
+				color.HiGreen("✔ %s (%s)", r.Branch, r.Path)
+			} else {
+				color.HiRed("❌ %s (%s) : %s", r.Branch, r.Path, r.Error)
+			}
+		}
+	}
+
+	if len(codes) == 0 {
+		exitSuccess()
+	}
+	code := ErrCodePartialFailure
+	if len(codes) == len(installs) {
+		code = Ternary(SliceContainsFunc(codes, func(c string) bool { return c != codes[0] }), ErrCodeFailed, codes[0])
+		dieCode(code, fmt.Sprintf("Les %d installations sont en échec (record battu)", len(installs)))
+	}
+	dieCode(code, fmt.Sprintf("%d installation(s) sur %d en échec (les autres vont bien, promis)", len(codes), len(installs)))
+}
+
+// branchList is --branch, which can be given several times
+type branchList []string
+
+func (b *branchList) String() string {
+	return strings.Join(*b, ",")
+}
+
+func (b *branchList) Set(s string) error {
+	*b = append(*b, s)
+	return nil
+}
+
+func actionName(install, update, uninstall, installOpenAsar, uninstallOpenAsar bool) string {
+	switch {
+	case install:
+		return "install"
+	case update:
+		return "repair"
+	case uninstall:
+		return "uninstall"
+	case installOpenAsar:
+		return "install-openasar"
+	case uninstallOpenAsar:
+		return "uninstall-openasar"
+	default:
+		return ""
+	}
+}
+
+// releaseVersionFlag is --version, which prints our version on its own and
+// picks the Bashcord release to install when given one. It is a bool flag so
+// that a bare --version keeps working, see joinVersionArg
+type releaseVersionFlag struct {
+	set     bool
+	release string
+}
+
+func (v *releaseVersionFlag) String() string {
+	return v.release
+}
+
+func (v *releaseVersionFlag) Set(s string) error {
+	v.set = true
+	if s != "true" {
+		v.release = s
+	}
+	return nil
+}
+
+func (v *releaseVersionFlag) IsBoolFlag() bool {
+	return true
+}
+
+// joinVersionArg turns --version <tag> into --version=<tag>, as flag.Parse
+// would stop at the tag otherwise
+func joinVersionArg(args []string) []string {
+	var joined []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if (arg == "-version" || arg == "--version") && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+			arg += "=" + args[i]
+		}
+		joined = append(joined, arg)
+	}
+	return joined
+}
+
+func listInstalls() {
+	installs := SliceMap(discords, func(d any) *InstallStatus {
+		return statusOf(d.(*DiscordInstall))
+	})
+	if LogJSON {
+		result.Data = Ternary(installs != nil, installs, []*InstallStatus{})
+		return
+	}
+	if len(installs) == 0 {
+		fmt.Println("Aucune installation Discord trouvée (tu es sûr d'avoir Discord ?)")
+		return
+	}
+
+	yesNo := func(b bool) string {
+		return Ternary(b, "oui", "non")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "BRANCHE\tVERSION\tPATCHÉE\tOPENASAR\tFLATPAK\tLECTURE SEULE\tSYSTEM ELECTRON\tBASHCORD\tEMPLACEMENT")
+	for _, s := range installs {
+		target := "-"
+		if s.AsarTarget != "" {
+			target = Ternary(s.TargetsCurrent, "à jour", "ailleurs : "+s.AsarTarget)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Branch, Ternary(s.DiscordVersion != "", s.DiscordVersion, "?"), yesNo(s.Patched), yesNo(s.OpenAsar),
+			yesNo(s.Flatpak), Ternary(s.Snap, "snap", Ternary(s.Nix, "nix", "non")), yesNo(s.SystemElectron), target, s.Path)
+	}
+	_ = w.Flush()
+}
+
+func listReleases() {
+	releases, err := ListReleases()
+	if err != nil {
+		dieCode(ErrCodeReleaseFetch, "Impossible de lister les versions : "+err.Error())
+	}
+	if LogJSON {
+		type release struct {
+			Tag       string `json:"tag"`
+			Hash      string `json:"hash"`
+			Name      string `json:"name"`
+			Installed bool   `json:"installed"`
+		}
+		result.Data = SliceMap(releases, func(r *GithubRelease) release {
+			return release{r.TagName, r.Hash(), r.Name, r.IsInstalled()}
+		})
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TAG\tHASH\tNOM\t")
+	for _, r := range releases {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.TagName, r.Hash(), r.Name, Ternary(r.IsInstalled(), "(installée)", ""))
+	}
+	_ = w.Flush()
+}
+
+func isValidRecoverMode(mode string) bool {
+	switch mode {
+	case "", "auto", "forward", "back":
+		return true
+	default:
+		return false
+	}
+}
+
+// recoverInterrupted deals with a patch or unpatch of di that was interrupted
+// last time, asking what to do if prompt is set
+func recoverInterrupted(di *DiscordInstall, mode string, prompt bool) {
+	action := Ternary(di.journal.Action == "patch", "patch", "dépatch")
+	Log.Warn("Le " + action + " de " + di.path + " a été interrompu (crash ? coupure de courant ? chat sur le clavier ?)")
+
+	if mode == "" {
+		mode = "auto"
+	}
+	if prompt {
+		choices := []string{
+			"Terminer le " + action + " (recommandé)",
+			"Annuler le " + action + " et revenir à l'état d'avant",
+		}
+		i, _, err := (&promptui.Select{
+			Label:    "Que veux-tu faire ?",
+			Items:    choices,
+			HideHelp: true,
+		}).Run()
+		handlePromptError(err)
+		mode = Ternary(i == 0, "forward", "back")
+	}
+
+	var err error
+	switch mode {
+	case "auto":
+		err = di.RecoverJournalAuto()
+	case "forward":
+		err = di.RecoverJournal(true)
+	case "back":
+		err = di.RecoverJournal(false)
+	}
+	if err != nil {
+		Log.Error("Impossible de récupérer "+di.path+" :", err)
+		result.discord = di
+		exitError(err)
+	}
+}
+
+func listBackups() {
+	backups, err := ListBackups()
+	if err != nil {
+		dieCode(ErrCodeFailed, "Impossible de lire les sauvegardes : "+err.Error())
+	}
+	if LogJSON {
+		result.Data = Ternary(backups != nil, backups, []*Backup{})
+		return
+	}
+	if len(backups) == 0 {
+		fmt.Println("Aucune sauvegarde (tu vis dangereusement)")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tDATE\tBRANCHE\tVERSION\tTAILLE\tRAISON\tEMPLACEMENT")
+	for _, b := range backups {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.1f Mo\t%s\t%s\n",
+			b.ID, b.CreatedAt.Format(time.DateTime), b.Branch, Ternary(b.DiscordVersion != "", b.DiscordVersion, "?"),
+			float64(b.Size)/1024/1024, b.Reason, b.InstallPath)
+	}
+	_ = w.Flush()
+}
+
+// restoreBackup restores the backup id to the install it was taken from, or
+// to the one given by --location / --branch
+func restoreBackup(id, location, branch string) error {
+	b, err := FindBackup(id)
+	if err != nil {
+		return err
+	}
+
+	var di *DiscordInstall
+	if location != "" || branch != "" {
+		di = PromptDiscord("restaurer", location, branch)
+	} else if di = ParseDiscord(b.InstallPath, b.Branch); di == nil {
+		return errors.New(b.InstallPath + " n'est plus une installation Discord valide. Indique-en une autre avec --location")
+	}
+	result.discord = di
+
+	return di.RestoreBackup(b)
+}
+
+// dryRun records what would have been done with --dry-run
+var dryRun *DryRun
+
 func exit(status int) {
+	if dryRun != nil {
+		reportDryRun()
+	}
+	if LogJSON {
+		printResult(status)
+		os.Exit(status)
+	}
 	if runtime.GOOS == "windows" && IsDoubleClickRun() && interactive {
 		fmt.Print("Appuie sur Entrée pour quitter (si tu y arrives)")
 		var b byte
@@ -244,12 +830,37 @@ func exit(status int) {
 	os.Exit(status)
 }
 
+func reportDryRun() {
+	ops := dryRun.Ops
+	dryRun = nil
+	if LogJSON {
+		result.DryRun = Ternary(ops != nil, ops, []DryRunOp{})
+		return
+	}
+
+	fmt.Println()
+	if len(ops) == 0 {
+		fmt.Println("--dry-run : rien n'aurait été touché.")
+		return
+	}
+	fmt.Println("--dry-run : rien n'a été touché. Voilà ce qui aurait été fait :")
+	for _, op := range ops {
+		fmt.Println("  " + op.String())
+	}
+}
+
 func exitSuccess() {
+	if LogJSON {
+		exit(0)
+	}
 	color.HiGreen("✔ Succès ! (incroyable)")
 	exit(0)
 }
 
 func exitFailure() {
+	if LogJSON {
+		exit(1)
+	}
 	color.HiRed("❌ Échec ! (comme d'habitude)")
 	exit(1)
 }
@@ -272,7 +883,7 @@ func PromptDiscord(action, dir, branch string) *DiscordInstall {
 				}
 			}
 		}
-		die("Aucune installation Discord trouvée. Essaie de la spécifier manuellement avec le flag --dir. Indice : snap n'est pas supporté (évidemment)")
+		dieCode(ErrCodeNotFound, "Aucune installation Discord trouvée. Essaie de la spécifier manuellement avec le flag --location (et installe Discord d'abord, évidemment)")
 	}
 
 	if branch != "" {
@@ -282,17 +893,21 @@ func PromptDiscord(action, dir, branch string) *DiscordInstall {
 				return install
 			}
 		}
-		die("Discord " + branch + " introuvable (tu es sûr qu'il existe ?)")
+		dieCode(ErrCodeNotFound, "Discord "+branch+" introuvable (tu es sûr qu'il existe ?)")
 	}
 
 	if dir != "" {
 		if discord := ParseDiscord(dir, branch); discord != nil {
 			return discord
 		} else {
-			die(dir + " n'est pas une installation Discord valide. Indice : snap n'est pas supporté (on t'avait prévenu)")
+			dieCode(ErrCodeNotFound, dir+" n'est pas une installation Discord valide. Indice : donne le dossier de base, celui avec resources dedans (on t'avait prévenu)")
 		}
 	}
 
+	if LogJSON {
+		die("--json ne pose pas de questions : indique l'installation Discord avec --branch ou --location")
+	}
+
 	items := SliceMap(discords, func(d any) string {
 		install := d.(*DiscordInstall)
 		//goland:noinspection GoDeprecation
@@ -325,6 +940,45 @@ func PromptDiscord(action, dir, branch string) *DiscordInstall {
 	}
 }
 
+// ConfirmKillDiscord says whether PreparePatch may close the running Discord of di
+func ConfirmKillDiscord(di *DiscordInstall) bool {
+	if killDiscord {
+		return true
+	}
+	if !promptKill {
+		Log.Warn("Discord " + di.branch + " tourne encore, je le laisse. Redémarre-le après, ou passe --kill pour que je le ferme moi-même.")
+		return false
+	}
+
+	_, err := (&promptui.Prompt{
+		Label:     "Discord " + di.branch + " tourne encore. Je le ferme" + Ternary(relaunchDiscord, " (et je le relance après)", "") + " ?",
+		IsConfirm: true,
+		Default:   "y",
+	}).Run()
+	if errors.Is(err, promptui.ErrInterrupt) {
+		exit(0)
+	}
+	if err != nil {
+		Log.Warn("Comme tu veux. Redémarre Discord après, sinon il risque de défaire le patch.")
+	}
+	return err == nil
+}
+
+// relaunch starts again the Discord of di that PreparePatch closed, unless
+// --no-relaunch. With --launch, di is started anyway once patched
+func relaunch(di *DiscordInstall, patched bool) {
+	var err error
+	switch {
+	case relaunchDiscord && di.relaunch != nil:
+		err = di.RelaunchDiscord()
+	case launchDiscord && patched:
+		err = di.LaunchDiscord()
+	}
+	if err != nil {
+		Log.Warn("Impossible de lancer Discord, lance-le toi-même :", err)
+	}
+}
+
 func InstallLatestBuilds() error {
 	return installLatestBuilds()
 }
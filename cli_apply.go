@@ -0,0 +1,369 @@
+//go:build cli
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	path "path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const applyUsage = `Usage : %s apply -f <fichier.yaml> [--dry-run] [--json]
+
+Amène les installations Discord de cette machine dans l'état décrit par le
+fichier, par exemple :
+
+  release: v1.2.3                   # tag ou hash, la dernière si absent
+  channel: stable                   # ou releaseSource: owner/repo[@tag]
+  bashcordDirectory: /opt/bashcord/bashcord.asar
+  installs:
+    - branch: stable
+      patched: true
+      openAsar: false
+    - path: /opt/discord-canary
+      patched: true
+      release: 1a2b3c4                # release et bashcordDirectory par installation
+      bashcordDirectory: /opt/bashcord/canary.asar
+
+Ce qui est absent n'est pas touché. Relancer apply ne refait rien si tout est
+déjà comme demandé.
+`
+
+// FleetSpec is the desired state of the machine, as given to apply
+type FleetSpec struct {
+	ReleaseSource     string         `yaml:"releaseSource"`
+	Channel           string         `yaml:"channel"`
+	Release           string         `yaml:"release"`
+	BashcordDirectory string         `yaml:"bashcordDirectory"`
+	Installs          []FleetInstall `yaml:"installs"`
+}
+
+// FleetInstall is the desired state of one install. Nil fields are left as is
+type FleetInstall struct {
+	Branch            string `yaml:"branch"`
+	Path              string `yaml:"path"`
+	Patched           *bool  `yaml:"patched"`
+	OpenAsar          *bool  `yaml:"openAsar"`
+	Release           string `yaml:"release"`
+	BashcordDirectory string `yaml:"bashcordDirectory"`
+}
+
+// An ApplyStep is one change apply makes
+type ApplyStep struct {
+	Op        string `json:"op"`
+	Path      string `json:"path,omitempty"`
+	Branch    string `json:"branch,omitempty"`
+	Directory string `json:"bashcordDirectory,omitempty"`
+	Release   string `json:"release,omitempty"`
+	Done      bool   `json:"done"`
+	Error     string `json:"error,omitempty"`
+
+	di      *DiscordInstall
+	release *GithubRelease
+}
+
+const (
+	StepDownload          = "download"
+	StepPatch             = "patch"
+	StepUnpatch           = "unpatch"
+	StepInstallOpenAsar   = "install-openasar"
+	StepUninstallOpenAsar = "uninstall-openasar"
+)
+
+func (s *ApplyStep) String() string {
+	switch s.Op {
+	case StepDownload:
+		return "télécharger Bashcord " + s.Release + " (" + s.release.TagName + ") vers " + s.Directory
+	case StepPatch:
+		return "patcher " + s.Branch + " (" + s.Path + ") avec " + s.Directory
+	case StepUnpatch:
+		return "dépatcher " + s.Branch + " (" + s.Path + ")"
+	case StepInstallOpenAsar:
+		return "installer OpenAsar sur " + s.Branch + " (" + s.Path + ")"
+	case StepUninstallOpenAsar:
+		return "désinstaller OpenAsar de " + s.Branch + " (" + s.Path + ")"
+	}
+	return s.Op
+}
+
+func applyMain(args []string) {
+	result.Action = "apply"
+
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, applyUsage, path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Bool("debug", false, "Activer les infos de debug (pour les masochistes)")
+	var jsonFlag = fs.Bool("json", false, "Afficher le résultat en JSON sur stdout et les logs en lignes JSON sur stderr")
+	var outputFlag = fs.String("output", "text", "Le format de sortie [text|json]")
+	var fileFlag = fs.String("f", "", "Le fichier décrivant l'état voulu")
+	var dryRunFlag = fs.Bool("dry-run", false, "Afficher ce qui serait fait, sans rien faire")
+	fs.BoolVar(&killDiscord, "kill", false, "Fermer Discord s'il tourne pendant qu'on le modifie (sinon je le laisse tourner)")
+	var noRelaunchFlag = fs.Bool("no-relaunch", false, "Ne pas relancer Discord après l'avoir fermé")
+	_ = fs.Parse(args)
+
+	LogJSON = *jsonFlag || *outputFlag == "json"
+	setupJSONOutput()
+	InitGithubDownloader()
+	discords = FindDiscords()
+
+	relaunchDiscord = !*noRelaunchFlag
+
+	if *fileFlag == "" || fs.NArg() != 0 {
+		fs.Usage()
+		exit(2)
+	}
+
+	spec, err := ReadFleetSpec(*fileFlag)
+	if err != nil {
+		dieCode(ErrCodeUsage, err.Error())
+	}
+
+	steps, err := PlanFleet(spec)
+	if err != nil {
+		Log.Error(err)
+		exitError(err)
+	}
+	result.Data = Ternary(steps != nil, steps, []*ApplyStep{})
+
+	if !LogJSON {
+		if len(steps) == 0 {
+			fmt.Println("Rien à faire, tout est déjà comme demandé (pour une fois).")
+		} else {
+			fmt.Println(Ternary(*dryRunFlag, "Ce qui serait fait :", "Ce qui va être fait :"))
+			for _, s := range steps {
+				fmt.Println("  -", s)
+			}
+			fmt.Println()
+		}
+	}
+	if *dryRunFlag || len(steps) == 0 {
+		exit(0)
+	}
+
+	// Discords closed by a step are started again once all steps are done
+	relaunchAll := func() {
+		for _, s := range steps {
+			if s.di != nil {
+				relaunch(s.di, false)
+			}
+		}
+	}
+	for _, s := range steps {
+		Log.Info("→", s)
+		if err = s.Run(); err != nil {
+			Log.Error(err)
+			s.Error = err.Error()
+			Log.Error("Arrêt ici, relance apply une fois le problème réglé pour reprendre")
+			relaunchAll()
+			exitError(err)
+		}
+		s.Done = true
+	}
+	relaunchAll()
+	exitSuccess()
+}
+
+// ReadFleetSpec reads and checks the spec file. Unknown keys are errors, a
+// typo shouldn't silently leave an install as is
+func ReadFleetSpec(file string) (*FleetSpec, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var spec FleetSpec
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err = dec.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("Invalid %s: %w", file, err)
+	}
+
+	for i, inst := range spec.Installs {
+		if (inst.Branch == "") == (inst.Path == "") {
+			return nil, fmt.Errorf("Invalid %s: install %d needs either branch or path", file, i+1)
+		}
+		if !isValidBranch(inst.Branch) {
+			return nil, fmt.Errorf("Invalid %s: install %d has unknown branch %s", file, i+1, inst.Branch)
+		}
+	}
+	return &spec, nil
+}
+
+// PlanFleet returns the steps that bring the installs to the state of spec,
+// in the order they have to run
+func PlanFleet(spec *FleetSpec) ([]*ApplyStep, error) {
+	source, err := fleetReleaseSource(spec)
+	if err != nil {
+		return nil, err
+	}
+	return planFleet(spec, source)
+}
+
+// planFleet is PlanFleet, with the releases of source
+func planFleet(spec *FleetSpec, source ReleaseSource) ([]*ApplyStep, error) {
+	releases := make(map[string]*GithubRelease)
+	getRelease := func(version string) (*GithubRelease, error) {
+		if r, ok := releases[version]; ok {
+			return r, nil
+		}
+		var r *GithubRelease
+		var err error
+		if version == "" {
+			r, err = source.FetchRelease()
+		} else {
+			r, err = FetchReleaseVersion(source, version)
+		}
+		if err != nil {
+			return nil, &codeError{ErrCodeReleaseFetch, "Failed to fetch release of " + source.String() + ": " + err.Error()}
+		}
+		releases[version] = r
+		return r, nil
+	}
+
+	// The release each Bashcord directory must hold, and which install asked for it
+	wanted := make(map[string]*GithubRelease)
+	wantedBy := make(map[string]string)
+	var downloads, changes []*ApplyStep
+	seen := make(map[string]bool)
+
+	for _, inst := range spec.Installs {
+		di, err := fleetDiscord(inst)
+		if err != nil {
+			return nil, err
+		}
+		// By branch and by path, or by two spellings of its path
+		if seen[path.Clean(di.path)] {
+			return nil, errors.New(di.path + " is listed more than once")
+		}
+		seen[path.Clean(di.path)] = true
+
+		dir := firstNonEmpty(inst.BashcordDirectory, spec.BashcordDirectory, EquicordDirectory)
+		if dir, err = path.Abs(dir); err != nil {
+			return nil, err
+		}
+		target, err := di.AsarTarget()
+		if err != nil {
+			Log.Warn(err)
+		}
+		pointsAtDir := target != "" && path.Clean(target) == dir
+
+		willBePatched := di.isPatched && pointsAtDir
+		if inst.Patched != nil {
+			willBePatched = *inst.Patched
+		}
+		if willBePatched {
+			r, err := getRelease(firstNonEmpty(inst.Release, spec.Release))
+			if err != nil {
+				return nil, err
+			}
+			if other, ok := wanted[dir]; ok && Ternary(r.Hash() != "", other.Hash() != r.Hash(), other.TagName != r.TagName) {
+				return nil, fmt.Errorf("%s and %s want different releases in %s, give them different bashcordDirectory", wantedBy[dir], di.path, dir)
+			}
+			if _, ok := wanted[dir]; !ok {
+				wanted[dir], wantedBy[dir] = r, di.path
+				// Dev installs bring their own build
+				if hash, _ := ReadEquicordHash(dir); hash != r.Hash() && !IsDevInstall {
+					downloads = append(downloads, &ApplyStep{Op: StepDownload, Directory: dir, Release: firstNonEmpty(r.Hash(), r.TagName), release: r})
+				}
+			}
+		}
+
+		step := func(op string) *ApplyStep {
+			return &ApplyStep{Op: op, Path: di.path, Branch: di.branch, Directory: Ternary(op == StepPatch, dir, ""), di: di}
+		}
+		if inst.Patched != nil {
+			if *inst.Patched && (!di.isPatched || !pointsAtDir) {
+				changes = append(changes, step(StepPatch))
+			} else if !*inst.Patched && di.isPatched {
+				changes = append(changes, step(StepUnpatch))
+			}
+		}
+		if inst.OpenAsar != nil && *inst.OpenAsar != di.IsOpenAsar() {
+			changes = append(changes, step(Ternary(*inst.OpenAsar, StepInstallOpenAsar, StepUninstallOpenAsar)))
+		}
+	}
+
+	return append(downloads, changes...), nil
+}
+
+// Run does the step. Patch steps rely on the downloads before them
+func (s *ApplyStep) Run() error {
+	switch s.Op {
+	case StepDownload:
+		if err := FS.MkdirAll(path.Dir(s.Directory), 0755); err != nil {
+			return err
+		}
+		return installRelease(s.release, s.Directory)
+	case StepPatch:
+		return s.di.patchWith(s.Directory)
+	case StepUnpatch:
+		return s.di.unpatch()
+	case StepInstallOpenAsar:
+		return s.di.InstallOpenAsar()
+	case StepUninstallOpenAsar:
+		return s.di.UninstallOpenAsar()
+	}
+	return errors.New("Unknown step " + s.Op)
+}
+
+func fleetReleaseSource(spec *FleetSpec) (ReleaseSource, error) {
+	if spec.ReleaseSource != "" && spec.Channel != "" {
+		return nil, errors.New("releaseSource and channel are mutually exclusive")
+	}
+	if spec.ReleaseSource != "" {
+		return ParseReleaseSource(spec.ReleaseSource)
+	}
+	if spec.Channel != "" {
+		config, err := ReadConfig()
+		if err != nil {
+			return nil, err
+		}
+		src, ok := channelSources(config)[spec.Channel]
+		if !ok {
+			return nil, errors.New("Unknown release channel " + spec.Channel)
+		}
+		return ParseReleaseSource(src)
+	}
+	return GetReleaseSource()
+}
+
+func fleetDiscord(inst FleetInstall) (*DiscordInstall, error) {
+	if inst.Path != "" {
+		if di := ParseDiscord(inst.Path, ""); di != nil {
+			return di, nil
+		}
+		return nil, &codeError{ErrCodeNotFound, inst.Path + " is not a valid Discord install"}
+	}
+
+	for _, b := range Ternary(inst.Branch == "auto", []string{"stable", "canary", "ptb"}, []string{inst.Branch}) {
+		for _, discord := range discords {
+			if di := discord.(*DiscordInstall); di.branch == b {
+				return di, nil
+			}
+		}
+	}
+	return nil, &codeError{ErrCodeNotFound, "No Discord " + inst.Branch + " install found"}
+}
+
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+//go:build cli && linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// fleetSource serves its releases, newest first
+type fleetSource []*GithubRelease
+
+func (s fleetSource) FetchRelease() (*GithubRelease, error)   { return s[0], nil }
+func (s fleetSource) ListReleases() ([]*GithubRelease, error) { return s, nil }
+func (fleetSource) String() string                            { return "test releases" }
+
+// releases returns v2 (9f8e7d6) and v1 (1a2b3c4, the one installed by
+// newFixture), and serves their desktop.asar
+func (fx *fixture) releases() fleetSource {
+	fx.exec.downloads = make(map[string][]byte)
+	var source fleetSource
+	for _, v := range [][2]string{{"v2", "9f8e7d6"}, {"v1", "1a2b3c4"}} {
+		url := "https://example.com/" + v[0] + "/desktop.asar"
+		fx.exec.downloads[url] = makeAsar("// Equicord " + v[1])
+		source = append(source, &GithubRelease{
+			Name:    "Bashcord " + v[1],
+			TagName: v[0],
+			Assets:  []GithubAsset{{Name: "desktop.asar", DownloadURL: url}},
+		})
+	}
+	return source
+}
+
+// plan is planFleet failing the test on error, with each step as its String
+func (fx *fixture) plan(spec *FleetSpec, source ReleaseSource) ([]*ApplyStep, []string) {
+	fx.t.Helper()
+	steps, err := planFleet(spec, source)
+	fx.must(err)
+	return steps, SliceMap(steps, (*ApplyStep).String)
+}
+
+func assertSteps(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("steps:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// applySteps runs steps, which must leave the Bashcord of the CLI as it is
+func (fx *fixture) applySteps(steps []*ApplyStep) {
+	fx.t.Helper()
+	for _, s := range steps {
+		fx.must(s.Run())
+	}
+	if EquicordDirectory != fixtureBashcord || InstalledHash != "1a2b3c4" || LatestHash != "1a2b3c4" {
+		fx.t.Errorf("apply changed the Bashcord of the CLI to %s, installed %s, latest %s", EquicordDirectory, InstalledHash, LatestHash)
+	}
+}
+
+func skipVerification(t *testing.T) {
+	old := SkipReleaseVerification
+	SkipReleaseVerification = true
+	t.Cleanup(func() { SkipReleaseVerification = old })
+}
+
+func TestApplyFleetIsIdempotent(t *testing.T) {
+	fx := newFixture(t)
+	skipVerification(t)
+	source := fx.releases()
+	fx.Normal("/opt/discord")
+	fx.Patched(fx.Normal("/opt/discord-canary"))
+	spec := &FleetSpec{
+		BashcordDirectory: "/opt/bashcord/bashcord.asar",
+		Installs: []FleetInstall{
+			{Path: "/opt/discord", Patched: Ptr(true)},
+			// Already as wanted
+			{Path: "/opt/discord-canary", Patched: Ptr(true), Release: "v1", BashcordDirectory: fixtureBashcord},
+		},
+	}
+
+	steps, got := fx.plan(spec, source)
+	assertSteps(t, got,
+		"télécharger Bashcord 9f8e7d6 (v2) vers /opt/bashcord/bashcord.asar",
+		"patcher stable (/opt/discord) avec /opt/bashcord/bashcord.asar")
+	fx.applySteps(steps)
+	fx.assertStub("/opt/discord/resources/app.asar", "/opt/bashcord/bashcord.asar")
+	if hash, _ := ReadEquicordHash("/opt/bashcord/bashcord.asar"); hash != "9f8e7d6" {
+		t.Errorf("downloaded Bashcord %s, want 9f8e7d6", hash)
+	}
+
+	_, got = fx.plan(spec, source)
+	assertSteps(t, got)
+}
+
+func TestPlanFleetConflictingReleases(t *testing.T) {
+	fx := newFixture(t)
+	source := fx.releases()
+	fx.Normal("/opt/discord")
+	fx.Normal("/opt/discord-canary")
+
+	_, err := planFleet(&FleetSpec{
+		BashcordDirectory: "/opt/bashcord/bashcord.asar",
+		Installs: []FleetInstall{
+			{Path: "/opt/discord", Patched: Ptr(true)},
+			{Path: "/opt/discord-canary", Patched: Ptr(true), Release: "v1"},
+		},
+	}, source)
+	if err == nil || !strings.Contains(err.Error(), "/opt/discord and /opt/discord-canary want different releases") {
+		t.Errorf("planFleet() = %v, want the conflict of /opt/discord and /opt/discord-canary", err)
+	}
+
+	// The same release by tag and by hash is no conflict, and downloaded once
+	_, got := fx.plan(&FleetSpec{
+		BashcordDirectory: "/opt/bashcord/bashcord.asar",
+		Installs: []FleetInstall{
+			{Path: "/opt/discord", Patched: Ptr(true), Release: "v2"},
+			{Path: "/opt/discord-canary", Patched: Ptr(true), Release: "9f8e7d6"},
+		},
+	}, source)
+	assertSteps(t, got,
+		"télécharger Bashcord 9f8e7d6 (v2) vers /opt/bashcord/bashcord.asar",
+		"patcher stable (/opt/discord) avec /opt/bashcord/bashcord.asar",
+		"patcher canary (/opt/discord-canary) avec /opt/bashcord/bashcord.asar")
+}
+
+func TestPlanFleetDuplicateInstalls(t *testing.T) {
+	fx := newFixture(t)
+	oldDiscords := discords
+	t.Cleanup(func() { discords = oldDiscords })
+	discords = []any{fx.parse(fx.Normal("/opt/discord"))}
+
+	_, err := planFleet(&FleetSpec{
+		Installs: []FleetInstall{
+			{Branch: "stable", Patched: Ptr(true)},
+			{Path: "/opt/discord/", OpenAsar: Ptr(true)},
+		},
+	}, fx.releases())
+	if err == nil || !strings.Contains(err.Error(), "listed more than once") {
+		t.Errorf("planFleet() = %v, want /opt/discord listed more than once", err)
+	}
+}
+
+func TestApplyFleetBashcordDirectoryPerInstall(t *testing.T) {
+	fx := newFixture(t)
+	skipVerification(t)
+	source := fx.releases()
+	fx.Normal("/opt/discord")
+	fx.Normal("/opt/discord-canary")
+	spec := &FleetSpec{
+		Release:           "v1",
+		BashcordDirectory: "/opt/bashcord/stable.asar",
+		Installs: []FleetInstall{
+			{Path: "/opt/discord", Patched: Ptr(true)},
+			{Path: "/opt/discord-canary", Patched: Ptr(true), Release: "v2", BashcordDirectory: "/opt/bashcord/canary.asar"},
+		},
+	}
+
+	steps, got := fx.plan(spec, source)
+	assertSteps(t, got,
+		"télécharger Bashcord 1a2b3c4 (v1) vers /opt/bashcord/stable.asar",
+		"télécharger Bashcord 9f8e7d6 (v2) vers /opt/bashcord/canary.asar",
+		"patcher stable (/opt/discord) avec /opt/bashcord/stable.asar",
+		"patcher canary (/opt/discord-canary) avec /opt/bashcord/canary.asar")
+	fx.applySteps(steps)
+	fx.assertStub("/opt/discord/resources/app.asar", "/opt/bashcord/stable.asar")
+	fx.assertStub("/opt/discord-canary/resources/app.asar", "/opt/bashcord/canary.asar")
+	for dir, want := range map[string]string{"/opt/bashcord/stable.asar": "1a2b3c4", "/opt/bashcord/canary.asar": "9f8e7d6"} {
+		if hash, _ := ReadEquicordHash(dir); hash != want {
+			t.Errorf("%s holds Bashcord %s, want %s", dir, hash, want)
+		}
+	}
+
+	_, got = fx.plan(spec, source)
+	assertSteps(t, got)
+}
@@ -0,0 +1,303 @@
+//go:build cli
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"vencord/asar"
+)
+
+const asarUsage = `Usage : %s asar <commande> [arguments]
+
+Commandes :
+  list <archive>              Lister le contenu d'une archive
+  extract <archive> <dossier> Extraire une archive (fichiers unpacked inclus)
+  pack [-unpack <motif>] <dossier> <archive>
+                              Créer une archive depuis un dossier
+  diff <archive A> <archive B>
+                              Comparer deux archives (code de sortie 1 si elles diffèrent)
+`
+
+func asarMain(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, asarUsage, path.Base(os.Args[0]))
+		exit(2)
+	}
+
+	fs := flag.NewFlagSet("asar "+args[0], flag.ExitOnError)
+	fs.Bool("debug", false, "Activer les infos de debug (pour les masochistes)")
+	var unpackFlag = fs.String("unpack", "", "pack : motif (glob) des fichiers à laisser hors de l'archive, ex. *.node")
+	_ = fs.Parse(args[1:])
+	rest := fs.Args()
+
+	var err error
+	switch args[0] {
+	case "list":
+		requireArgs(rest, 1)
+		err = asarList(rest[0])
+	case "extract":
+		requireArgs(rest, 2)
+		err = asarExtract(rest[0], rest[1])
+	case "pack":
+		requireArgs(rest, 2)
+		err = asarPack(rest[0], rest[1], *unpackFlag)
+	case "diff":
+		requireArgs(rest, 2)
+		var same bool
+		same, err = asarDiff(rest[0], rest[1], os.Stdout)
+		if err == nil && !same {
+			exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, asarUsage, path.Base(os.Args[0]))
+		exit(2)
+	}
+
+	if err != nil {
+		Log.Error(err)
+		exit(1)
+	}
+	exit(0)
+}
+
+func requireArgs(args []string, n int) {
+	if len(args) != n {
+		fmt.Fprintf(os.Stderr, asarUsage, path.Base(os.Args[0]))
+		exit(2)
+	}
+}
+
+func asarList(file string) error {
+	a, err := asar.Open(file)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	return a.Walk(func(name string, e *asar.Entry) error {
+		line := "/" + name
+		switch {
+		case e.IsLink():
+			line += " -> " + e.Link
+		case e.Unpacked && !e.IsDir():
+			line += " [unpacked]"
+		}
+		if e.Executable {
+			line += " [exécutable]"
+		}
+		fmt.Println(line)
+		return nil
+	})
+}
+
+func asarExtract(file, dest string) error {
+	a, err := asar.Open(file)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	if err = os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	return a.Walk(func(name string, e *asar.Entry) error {
+		out := filepath.Join(dest, filepath.FromSlash(name))
+		Log.Debug("Extracting", name, "to", out)
+		if err := checkInside(dest, out); err != nil {
+			return err
+		}
+
+		switch {
+		case e.IsDir():
+			return os.MkdirAll(out, 0755)
+		case e.IsLink():
+			if err := checkInside(dest, filepath.Join(dest, filepath.FromSlash(e.Link))); err != nil {
+				return fmt.Errorf("Link %s: %w", name, err)
+			}
+			// Links are relative to the archive root, symlinks to their own directory
+			target, err := filepath.Rel(path.Dir("/"+name), "/"+e.Link)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(filepath.FromSlash(target), out)
+		}
+
+		r, err := a.Open(name)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, Ternary[os.FileMode](e.Executable, 0755, 0644))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if _, err = io.Copy(f, r); err != nil {
+			return fmt.Errorf("Failed to extract %s: %w", name, err)
+		}
+		return f.Close()
+	})
+}
+
+// checkInside refuses p unless it is dest or below it
+func checkInside(dest, p string) error {
+	rel, err := filepath.Rel(dest, p)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("%s is outside of %s", p, dest)
+	}
+	return nil
+}
+
+func asarPack(dir, file, unpack string) error {
+	if !IsDirectory(dir) {
+		return errors.New(dir + " n'est pas un dossier (on pack pas du vent)")
+	}
+	if _, err := path.Match(unpack, ""); err != nil {
+		return fmt.Errorf("Motif --unpack invalide : %w", err)
+	}
+
+	var isUnpacked func(string) bool
+	if unpack != "" {
+		isUnpacked = func(name string) bool {
+			matchBase, _ := path.Match(unpack, path.Base(name))
+			matchFull, _ := path.Match(unpack, name)
+			return matchBase || matchFull
+		}
+	}
+	return asar.CreateFromDir(dir, file, isUnpacked)
+}
+
+// asarDiff prints entries that were added (+), removed (-) or changed (~)
+// between archives a and b, and reports whether there were none
+func asarDiff(fileA, fileB string, out io.Writer) (bool, error) {
+	a, err := asar.Open(fileA)
+	if err != nil {
+		return false, err
+	}
+	defer a.Close()
+
+	b, err := asar.Open(fileB)
+	if err != nil {
+		return false, err
+	}
+	defer b.Close()
+
+	entriesA, entriesB := asarEntries(a), asarEntries(b)
+
+	names := make([]string, 0, len(entriesA)+len(entriesB))
+	for name := range entriesA {
+		names = append(names, name)
+	}
+	for name := range entriesB {
+		if _, ok := entriesA[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	same := true
+	for _, name := range names {
+		ea, inA := entriesA[name]
+		eb, inB := entriesB[name]
+
+		var sign, reason string
+		switch {
+		case !inA:
+			sign = "+"
+		case !inB:
+			sign = "-"
+		default:
+			reason, err = asarEntryDiff(a, b, name, ea, eb)
+			if err != nil {
+				return false, err
+			}
+			if reason == "" {
+				continue
+			}
+			sign = "~"
+		}
+
+		same = false
+		line := sign + " /" + name
+		if reason != "" {
+			line += " " + reason
+		}
+		_, _ = fmt.Fprintln(out, line)
+	}
+	return same, nil
+}
+
+func asarEntries(a *asar.Archive) map[string]*asar.Entry {
+	entries := make(map[string]*asar.Entry)
+	_ = a.Walk(func(name string, e *asar.Entry) error {
+		entries[name] = e
+		return nil
+	})
+	return entries
+}
+
+// asarEntryDiff describes how ea and eb differ, or returns "" if they don't
+func asarEntryDiff(a, b *asar.Archive, name string, ea, eb *asar.Entry) (string, error) {
+	switch {
+	case ea.IsDir() != eb.IsDir() || ea.IsLink() != eb.IsLink():
+		return "(type)", nil
+	case ea.IsDir():
+		return "", nil
+	case ea.IsLink():
+		return Ternary(ea.Link == eb.Link, "", "(lien : "+ea.Link+" -> "+eb.Link+")"), nil
+	case ea.Size != eb.Size:
+		return fmt.Sprintf("(taille : %d -> %d)", ea.Size, eb.Size), nil
+	case ea.Executable != eb.Executable:
+		return "(exécutable)", nil
+	case ea.Unpacked != eb.Unpacked:
+		return "(unpacked)", nil
+	}
+
+	hashA, err := asarEntryHash(a, name, ea)
+	if err != nil {
+		return "", err
+	}
+	hashB, err := asarEntryHash(b, name, eb)
+	if err != nil {
+		return "", err
+	}
+	return Ternary(hashA == hashB, "", "(contenu)"), nil
+}
+
+func asarEntryHash(a *asar.Archive, name string, e *asar.Entry) (string, error) {
+	if e.Integrity != nil && e.Integrity.Algorithm == asar.IntegrityAlgorithm {
+		return e.Integrity.Hash, nil
+	}
+
+	r, err := a.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	integrity, _, err := asar.ComputeIntegrity(r)
+	if err != nil {
+		return "", err
+	}
+	return integrity.Hash, nil
+}
@@ -0,0 +1,64 @@
+//go:build cli && linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"os"
+	path "path/filepath"
+	"testing"
+	"vencord/asar"
+)
+
+func TestAsarExtractStaysInside(t *testing.T) {
+	for name, target := range map[string]string{
+		"parent":   "../../outside",
+		"absolute": "/../outside",
+		"sibling":  "../dest-evil/x",
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			w := asar.NewWriter()
+			if err := w.AddLink("evil", target); err != nil {
+				t.Fatal(err)
+			}
+			file := path.Join(dir, "app.asar")
+			if err := w.WriteFile(file); err != nil {
+				t.Fatal(err)
+			}
+
+			dest := path.Join(dir, "dest")
+			if err := asarExtract(file, dest); err == nil {
+				t.Errorf("asarExtract of a link to %s succeeded", target)
+			}
+			if _, err := os.Lstat(path.Join(dest, "evil")); !os.IsNotExist(err) {
+				t.Errorf("asarExtract created the link to %s: %v", target, err)
+			}
+		})
+	}
+
+	// Links within dest are fine
+	dir := t.TempDir()
+	w := asar.NewWriter()
+	if err := w.AddBytes("sub/index.js", []byte("1"), asar.FileOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddLink("index.js", "sub/index.js"); err != nil {
+		t.Fatal(err)
+	}
+	file := path.Join(dir, "app.asar")
+	if err := w.WriteFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := asarExtract(file, path.Join(dir, "dest")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(path.Join(dir, "dest", "index.js")); err != nil || string(b) != "1" {
+		t.Errorf("index.js = %q, %v, want the contents of sub/index.js", b, err)
+	}
+}
@@ -0,0 +1,167 @@
+//go:build cli
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	path "path/filepath"
+
+	"github.com/fatih/color"
+)
+
+// With --json (or --output json) the cli prints a single Result on stdout
+// when it exits and logs json lines on stderr, see Handler.Log. Scripts should
+// look at ErrorCode, Error is meant for humans
+const (
+	ErrCodeUsage        = "usage"
+	ErrCodeNotFound     = "discord_not_found"
+	ErrCodeReleaseFetch = "release_fetch_failed"
+	ErrCodeChecksum     = "checksum_mismatch"
+	ErrCodePermission   = "permission_denied"
+	ErrCodeNothingToDo  = "nothing_to_do"
+	ErrCodeReadOnly     = "read_only_install"
+	ErrCodeFailed       = "failed"
+	// Some of several installs failed, see Result.Installs
+	ErrCodePartialFailure = "partial_failure"
+)
+
+// codeError is an error with its own error code
+type codeError struct {
+	code, msg string
+}
+
+func (e *codeError) Error() string {
+	return e.msg
+}
+
+type Result struct {
+	Action    string `json:"action"`
+	Success   bool   `json:"success"`
+	ErrorCode string `json:"errorCode,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Install is the Discord install the action was done on, if any
+	Install *InstallStatus `json:"install,omitempty"`
+	// Installs is the outcome for each install with --all or several --branch
+	Installs      []*InstallResult `json:"installs,omitempty"`
+	InstalledHash string           `json:"installedHash"`
+	LatestHash    string           `json:"latestHash"`
+	// Data is the output of actions listing things
+	Data any `json:"data,omitempty"`
+	// DryRun is what would have been done with --dry-run
+	DryRun []DryRunOp `json:"dryRun,omitempty"`
+
+	discord *DiscordInstall
+}
+
+type InstallStatus struct {
+	Path           string `json:"path"`
+	Branch         string `json:"branch"`
+	DiscordVersion string `json:"discordVersion,omitempty"`
+	Patched        bool   `json:"patched"`
+	OpenAsar       bool   `json:"openAsar"`
+	Flatpak        bool   `json:"flatpak"`
+	Snap           bool   `json:"snap"`
+	Nix            bool   `json:"nix"`
+	SystemElectron bool   `json:"systemElectron"`
+	// AsarTarget is the Bashcord asar the patched app.asar loads
+	AsarTarget string `json:"asarTarget,omitempty"`
+	// TargetsCurrent is whether AsarTarget is the one we install to
+	TargetsCurrent bool `json:"targetsCurrent"`
+}
+
+type InstallResult struct {
+	*InstallStatus
+	Success   bool   `json:"success"`
+	ErrorCode string `json:"errorCode,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+var result Result
+
+// resultOutput is where the result goes. Everything else printed to stdout,
+// like the output of commands we run, goes to stderr in json mode
+var resultOutput = os.Stdout
+
+func setupJSONOutput() {
+	if LogJSON {
+		os.Stdout = os.Stderr
+		color.NoColor = true
+	}
+}
+
+func statusOf(di *DiscordInstall) *InstallStatus {
+	target, err := di.AsarTarget()
+	if err != nil {
+		Log.Warn(err)
+	}
+	return &InstallStatus{
+		Path:           di.path,
+		Branch:         di.branch,
+		DiscordVersion: di.DiscordVersion(),
+		Patched:        di.isPatched,
+		OpenAsar:       di.IsOpenAsar(),
+		Flatpak:        di.isFlatpak,
+		Snap:           di.isSnap,
+		Nix:            di.isNix,
+		SystemElectron: di.isSystemElectron,
+		AsarTarget:     target,
+		TargetsCurrent: target != "" && path.Clean(target) == path.Clean(EquicordDirectory),
+	}
+}
+
+func errorCode(err error) string {
+	var ce *codeError
+	switch {
+	case errors.As(err, &ce):
+		return ce.code
+	case errors.Is(err, os.ErrPermission):
+		return ErrCodePermission
+	case errors.Is(err, ErrChecksumMismatch):
+		return ErrCodeChecksum
+	case errors.Is(err, ErrReadOnlyInstall):
+		return ErrCodeReadOnly
+	default:
+		return ErrCodeFailed
+	}
+}
+
+// exitError exits with err as the error of the result. It is expected to
+// be logged already
+func exitError(err error) {
+	result.ErrorCode = errorCode(err)
+	result.Error = err.Error()
+	exitFailure()
+}
+
+func dieCode(code, msg string) {
+	result.ErrorCode = code
+	result.Error = msg
+	die(msg)
+}
+
+func printResult(status int) {
+	result.Success = status == 0
+	if !result.Success && result.ErrorCode == "" {
+		result.ErrorCode = ErrCodeFailed
+	}
+	if result.discord != nil {
+		result.Install = statusOf(result.discord)
+	}
+	result.InstalledHash = InstalledHash
+	result.LatestHash = LatestHash
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		panic(err)
+	}
+	_, _ = fmt.Fprintln(resultOutput, string(b))
+}
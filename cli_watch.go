@@ -0,0 +1,239 @@
+//go:build cli
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	path "path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Discord writes lots of files while updating, only look once it is done
+const watchDebounce = 5 * time.Second
+
+const ServiceName = "bashcord-watch.service"
+
+// watchMain keeps every patched install patched, re-patching them whenever a
+// Discord update drops the patch. It only returns on error
+func watchMain() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	discords = writableInstalls(discords)
+
+	// Installs to keep patched, by path
+	keepPatched := make(map[string]bool)
+	// Patch dirs a journal showed up in, meaning the user (or we) just patched
+	// or unpatched them. Their new state is what they want, not an update
+	touched := make(map[string]bool)
+	for _, discord := range discords {
+		if di := discord.(*DiscordInstall); di.isPatched {
+			keepPatched[di.path] = true
+			Log.Info("Je garde", di.path, "patchée")
+		}
+	}
+	if len(keepPatched) == 0 {
+		Log.Warn("Aucune installation patchée pour l'instant. Je surveille quand même, patche-en une et je m'en occupe.")
+	}
+
+	addWatches := func() {
+		for _, discord := range discords {
+			for _, dir := range watchDirs(discord.(*DiscordInstall)) {
+				if err := watcher.Add(dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+					Log.Warn("Impossible de surveiller", dir+" :", err)
+				}
+			}
+		}
+	}
+	addWatches()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+
+	Log.Info("Surveillance de", len(discords), "installation(s) Discord. Ctrl+C pour arrêter.")
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			Log.Debug("Watch event:", event)
+			if path.Base(event.Name) == JournalFileName && event.Has(fsnotify.Create) {
+				touched[path.Dir(event.Name)] = true
+			}
+			debounce.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			Log.Warn("Erreur de surveillance :", err)
+		case <-debounce.C:
+			repatchUpdated(keepPatched, touched)
+			// Updates may replace the directories we watch
+			addWatches()
+		case <-signals:
+			Log.Info("Arrêt de la surveillance")
+			return nil
+		}
+	}
+}
+
+// watchDirs returns the directories whose changes may mean di was updated
+func watchDirs(di *DiscordInstall) []string {
+	dirs := []string{di.path, di.patchDir()}
+	// Flatpak updates swap the active symlink inside current
+	if i := strings.Index(di.path, "/current/active/files/"); i != -1 {
+		dirs = append(dirs, di.path[:i]+"/current")
+	}
+	return dirs
+}
+
+// repatchUpdated re-patches installs that should be patched but aren't
+// anymore. Installs that were patched or unpatched by the installer since the
+// last check, as told by the journals in touched, are left as they are
+func repatchUpdated(keepPatched, touched map[string]bool) {
+	for i, discord := range discords {
+		old := discord.(*DiscordInstall)
+		di := ParseDiscord(old.path, old.branch)
+		if di == nil {
+			// Probably mid-update, we'll get another event
+			continue
+		}
+		di.isFlatpak = old.isFlatpak
+		discords[i] = di
+
+		if di.appPath != old.appPath {
+			Log.Info("Nouvelle version de Discord détectée :", di.appPath)
+		}
+
+		if touched[di.patchDir()] {
+			if keepPatched[di.path] != di.isPatched {
+				Log.Info(di.path, Ternary(di.isPatched, "a été patchée, je la garderai patchée", "a été dépatchée, je la laisse tranquille"))
+			}
+			keepPatched[di.path] = di.isPatched
+			continue
+		}
+		if di.isPatched || !keepPatched[di.path] {
+			continue
+		}
+
+		Log.Info(di.path, "a perdu son patch (merci la mise à jour de Discord). Je repatche...")
+		if err := di.patch(); err != nil {
+			Log.Error("Impossible de repatcher", di.path+" :", err)
+		} else {
+			relaunch(di, false)
+		}
+	}
+	clear(touched)
+}
+
+// writableInstalls returns those of discords we may write to, warning about
+// the others. As a user service, --watch can't re-patch installs of the
+// system like /opt/discord, so it leaves them alone instead of failing
+func writableInstalls(discords []any) []any {
+	return SliceFilter(discords, func(discord any) bool {
+		di := discord.(*DiscordInstall)
+		dir := di.patchDir()
+		f, err := FS.CreateTemp(dir, ".bashcord-*")
+		if err != nil {
+			hint := "Repatche-la toi-même (avec sudo) après chaque mise à jour de Discord, ou patche une copie avec --copy-to."
+			if di.readOnly() {
+				hint = "Patche une copie avec --copy-to."
+			}
+			Log.Warn("Je n'ai pas le droit d'écrire dans", dir+", je ne surveille pas", di.path+". "+hint)
+			return false
+		}
+		_ = f.Close()
+		_ = FS.Remove(f.Name())
+		return true
+	})
+}
+
+// installService installs a systemd user service running --watch
+func installService() error {
+	if runtime.GOOS != "linux" {
+		return errors.New("--install-service n'existe que sous Linux (systemd), désolé")
+	}
+	if os.Getuid() == 0 {
+		return errors.New("--install-service installe un service utilisateur, relance-moi sans sudo")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = path.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	configHome, err := os.UserConfigDir()
+	if err != nil {
+		return err
+	}
+	unitDir := path.Join(configHome, "systemd", "user")
+	if err = FS.MkdirAll(unitDir, 0755); err != nil {
+		return err
+	}
+
+	unit := "[Unit]\n" +
+		"Description=Bashcord auto-repair: re-patches Discord after it updates\n" +
+		"After=graphical-session.target\n" +
+		"\n" +
+		"[Service]\n" +
+		"ExecStart=" + systemdQuote(exe) + " --watch\n" +
+		"Restart=on-failure\n" +
+		"RestartSec=30\n"
+	// Make the service use the same Bashcord as we do
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, "BASHCORD_") || strings.HasPrefix(env, "EQUICORD_") {
+			unit += "Environment=" + systemdQuote(env) + "\n"
+		}
+	}
+	unit += "\n" +
+		"[Install]\n" +
+		"WantedBy=default.target\n"
+
+	unitFile := path.Join(unitDir, ServiceName)
+	if err = FS.WriteFile(unitFile, []byte(unit), 0644); err != nil {
+		return err
+	}
+	Log.Info("Service écrit dans", unitFile)
+	// Warn now about what the service will skip
+	writableInstalls(discords)
+
+	for _, args := range [][]string{{"--user", "daemon-reload"}, {"--user", "enable", "--now", ServiceName}} {
+		if err = Exec.Run("systemctl", args...); err != nil {
+			return fmt.Errorf("systemctl %s a échoué, lance-le toi-même : %w", strings.Join(args, " "), err)
+		}
+	}
+	Log.Info("Service activé. Logs : journalctl --user -u " + ServiceName)
+	return nil
+}
+
+// systemdQuote quotes s for a systemd unit file
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "%", "%%")
+	return `"` + s + `"`
+}
@@ -0,0 +1,175 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	path "path/filepath"
+)
+
+// The config file, BaseDir/config.json, holds the preferences of both the cli
+// and the gui. Every key is optional. Keys we don't know, for example written
+// by a newer installer, are ignored and kept as is when saving, at the top
+// level and under "gui".
+const configVersion = 1
+
+// configMigrations[i] upgrades a config of version i to version i+1. They work
+// on the raw json so they can rename, move or drop keys
+var configMigrations = []func(raw map[string]json.RawMessage) error{
+	// 0 -> 1: the unversioned config only had the release settings, which are
+	// unchanged. Everything else gets its default
+	func(raw map[string]json.RawMessage) error {
+		return nil
+	},
+}
+
+type Config struct {
+	Version int `json:"version"`
+	// ReleaseSource overrides where Bashcord is downloaded from, see ParseReleaseSource
+	ReleaseSource string `json:"releaseSource"`
+	// Channel is the release channel to install from, see Channels
+	Channel string `json:"channel"`
+	// Channels adds channels or overrides the release source of existing ones
+	Channels map[string]string `json:"channels"`
+	// Branch is the preferred Discord branch, the default of --branch. Empty
+	// for none, in which case the cli asks
+	Branch string `json:"branch"`
+	// SearchPaths are more directories FindDiscords looks in on Linux, see
+	// searchDirs
+	SearchPaths []string `json:"searchPaths,omitempty"`
+	// SearchDepth is how deep below each search directory FindDiscords looks.
+	// 0 is the default, 1: only the directories right in them
+	SearchDepth int            `json:"searchDepth,omitempty"`
+	GUI         GUIPreferences `json:"gui"`
+
+	// raw is the config as read, so saving keeps keys we don't know
+	raw map[string]json.RawMessage
+}
+
+type GUIPreferences struct {
+	Theme         string  `json:"theme"`
+	Volume        float64 `json:"volume"`
+	AutoUpdate    bool    `json:"autoUpdate"`
+	Notifications bool    `json:"notifications"`
+	CompactMode   bool    `json:"compactMode"`
+	Animations    bool    `json:"animations"`
+	// LaunchAfterPatch starts Discord once patched
+	LaunchAfterPatch bool   `json:"launchAfterPatch"`
+	InstallCount     int    `json:"installCount"`
+	LastInstallTime  string `json:"lastInstallTime"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Version: configVersion,
+		GUI: GUIPreferences{
+			Theme:         "fishstick",
+			Volume:        0.05,
+			AutoUpdate:    true,
+			Notifications: true,
+			Animations:    true,
+		},
+	}
+}
+
+func configPath() string {
+	return path.Join(BaseDir, "config.json")
+}
+
+// ReadConfig reads the config file, migrating it to the current version. A
+// missing file is the default config
+func ReadConfig() (*Config, error) {
+	config := defaultConfig()
+
+	b, err := FS.ReadFile(configPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return config, nil
+		}
+		return nil, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", configPath(), err)
+	}
+
+	version := 0
+	if v, ok := raw["version"]; ok {
+		if err = json.Unmarshal(v, &version); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: invalid version: %w", configPath(), err)
+		}
+	}
+	if version < 0 {
+		return nil, fmt.Errorf("Failed to parse %s: invalid version %d", configPath(), version)
+	}
+	if version > configVersion {
+		Log.Debug(configPath(), "is from a newer installer (version", version, "), some settings may be ignored")
+	}
+	for ; version < configVersion; version++ {
+		Log.Debug("Migrating", configPath(), "from version", version, "to", version+1)
+		if err = configMigrations[version](raw); err != nil {
+			return nil, fmt.Errorf("Failed to migrate %s to version %d: %w", configPath(), version+1, err)
+		}
+	}
+	raw["version"], _ = json.Marshal(version)
+
+	if b, err = json.Marshal(raw); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, config); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", configPath(), err)
+	}
+	config.raw = raw
+	return config, nil
+}
+
+// Save atomically writes the config, keeping unknown keys of the file it was
+// read from
+func (config *Config) Save() error {
+	b, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	var out map[string]json.RawMessage
+	if err = json.Unmarshal(b, &out); err != nil {
+		return err
+	}
+	keepUnknown(out, config.raw)
+	// The gui keeps its own preferences, which a newer installer may add to
+	if gui, ok := config.raw["gui"]; ok {
+		var rawGUI, outGUI map[string]json.RawMessage
+		if json.Unmarshal(gui, &rawGUI) == nil && json.Unmarshal(out["gui"], &outGUI) == nil {
+			keepUnknown(outGUI, rawGUI)
+			if out["gui"], err = json.Marshal(outGUI); err != nil {
+				return err
+			}
+		}
+	}
+
+	if b, err = json.MarshalIndent(out, "", "\t"); err != nil {
+		return err
+	}
+	if err = FS.WriteFile(configPath(), b, 0644); err != nil {
+		return fmt.Errorf("Failed to save %s: %w", configPath(), err)
+	}
+	_ = FixOwnership(configPath())
+	return nil
+}
+
+// keepUnknown copies into out the keys of raw it doesn't have
+func keepUnknown(out, raw map[string]json.RawMessage) {
+	for key, value := range raw {
+		if _, known := out[key]; !known {
+			out[key] = value
+		}
+	}
+}
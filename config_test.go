@@ -0,0 +1,104 @@
+//go:build linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// readSaved returns the config file as saved, key by key
+func (fx *fixture) readSaved() map[string]json.RawMessage {
+	var saved map[string]json.RawMessage
+	fx.must(json.Unmarshal(fx.read(configPath()), &saved))
+	return saved
+}
+
+func TestConfigMigration(t *testing.T) {
+	fx := newFixture(t)
+	oldMigrations := configMigrations
+	t.Cleanup(func() { configMigrations = oldMigrations })
+	// Pretend 0 -> 1 renamed the key of the release channel
+	configMigrations = []func(raw map[string]json.RawMessage) error{
+		func(raw map[string]json.RawMessage) error {
+			raw["channel"] = raw["releaseChannel"]
+			delete(raw, "releaseChannel")
+			return nil
+		},
+	}
+	fx.must(fx.fs.WriteFile(configPath(), []byte(`{
+		"releaseSource": "someone/Bashcord",
+		"releaseChannel": "beta",
+		"fromTheFuture": {"nested": [1, 2]}
+	}`), 0644))
+
+	config, err := ReadConfig()
+	fx.must(err)
+	if config.Version != configVersion || config.Channel != "beta" || config.ReleaseSource != "someone/Bashcord" {
+		t.Errorf("migrated config = %+v", config)
+	}
+	if config.GUI != defaultConfig().GUI {
+		t.Errorf("GUI preferences of an old config = %+v, want the defaults", config.GUI)
+	}
+
+	config.Branch = "canary"
+	fx.must(config.Save())
+	saved := fx.readSaved()
+	var future bytes.Buffer
+	if json.Compact(&future, saved["fromTheFuture"]) != nil || future.String() != `{"nested":[1,2]}` {
+		t.Errorf("unknown key saved as %s", saved["fromTheFuture"])
+	}
+	if _, ok := saved["releaseChannel"]; ok {
+		t.Error("saved the key the migration removed")
+	}
+	for key, want := range map[string]string{"version": "1", "channel": `"beta"`, "branch": `"canary"`} {
+		if string(saved[key]) != want {
+			t.Errorf("saved %s = %s, want %s", key, saved[key], want)
+		}
+	}
+
+	// Reading what we saved changes nothing
+	again, err := ReadConfig()
+	fx.must(err)
+	if again.Channel != "beta" || again.Branch != "canary" {
+		t.Errorf("config read back = %+v", again)
+	}
+}
+
+func TestConfigFromNewerInstaller(t *testing.T) {
+	fx := newFixture(t)
+	fx.must(fx.fs.WriteFile(configPath(), []byte(`{"version": 99, "channel": "nightly", "newSetting": true, "gui": {"theme": "dark", "newGUISetting": 3}}`), 0644))
+
+	config, err := ReadConfig()
+	fx.must(err)
+	if config.Channel != "nightly" {
+		t.Errorf("channel = %q, want nightly", config.Channel)
+	}
+	fx.must(config.Save())
+
+	saved := fx.readSaved()
+	if string(saved["version"]) != "99" || string(saved["newSetting"]) != "true" {
+		t.Errorf("saved version %s and newSetting %s, want them untouched", saved["version"], saved["newSetting"])
+	}
+	var gui map[string]json.RawMessage
+	fx.must(json.Unmarshal(saved["gui"], &gui))
+	if string(gui["theme"]) != `"dark"` || string(gui["newGUISetting"]) != "3" {
+		t.Errorf("saved gui theme %s and newGUISetting %s, want them untouched", gui["theme"], gui["newGUISetting"])
+	}
+}
+
+func TestConfigNegativeVersion(t *testing.T) {
+	fx := newFixture(t)
+	fx.must(fx.fs.WriteFile(configPath(), []byte(`{"version": -1}`), 0644))
+
+	if _, err := ReadConfig(); err == nil {
+		t.Error("ReadConfig() of version -1 succeeded")
+	}
+}
@@ -11,8 +11,12 @@ import (
 	"image/color"
 )
 
-const ReleaseUrl = "https://api.github.com/repos/BashOnZsh/Bashcord/releases/tags/Latest"
-const InstallerReleaseUrl = "https://api.github.com/repos/Equicord/Equilotl/releases/latest"
+const GithubApiUrl = "https://api.github.com"
+
+// DefaultReleaseSource is used unless another one is configured, see GetReleaseSource
+const DefaultReleaseSource = "BashOnZsh/Bashcord@Latest"
+
+var InstallerReleaseSource = &GithubSource{Owner: "Equicord", Repo: "Equilotl"}
 
 var UserAgent = "Equilotl/" + buildinfo.InstallerGitHash + " (https://github.com/Equicord/Equilotl)"
 
@@ -0,0 +1,168 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	path "path/filepath"
+	"strings"
+)
+
+// Installs we can't patch in place, like snaps, are copied somewhere writable
+// and the copy is patched instead. The copy is marked with copyMarker, which
+// holds the path it was copied from, so that copying again replaces it but
+// never anything else
+
+const copyMarker = ".bashcord-copy"
+
+// CopyTo copies di to dest and returns the copy. An earlier copy at dest is
+// replaced, anything else there is an error
+func (di *DiscordInstall) CopyTo(dest string) (*DiscordInstall, error) {
+	dest = path.Clean(dest)
+	if dest == path.Clean(di.path) || isUnderDir(dest, di.path) {
+		return nil, errors.New("Can't copy " + di.path + " into itself")
+	}
+	if ExistsFile(dest) && !IsCopyOf(dest, di.path) {
+		return nil, errors.New(dest + " already exists and isn't a copy of " + di.path)
+	}
+
+	Log.Info("Copying", di.path, "to", dest+"...")
+	if err := mkdirAllOwned(path.Dir(dest)); err != nil {
+		return nil, err
+	}
+	// Copy next to dest first so that a failed copy leaves no half install
+	// behind. Everything in stage is ours, and removed once done: a failed
+	// copy, or the previous one
+	stage, err := FS.MkdirTemp(path.Dir(dest), "."+path.Base(dest)+"-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := FS.RemoveAll(stage); err != nil {
+			Log.Warn("Failed to remove", stage+":", err)
+		}
+	}()
+
+	tmp := path.Join(stage, "copy")
+	if err = copyDir(di.path, tmp); err != nil {
+		return nil, err
+	}
+	if err = FS.WriteFile(path.Join(tmp, copyMarker), []byte(di.path), 0644); err != nil {
+		return nil, err
+	}
+
+	old := path.Join(stage, "old")
+	if ExistsFile(dest) {
+		if err = FS.Rename(dest, old); err != nil {
+			return nil, err
+		}
+	}
+	if err = FS.Rename(tmp, dest); err != nil {
+		if ExistsFile(old) {
+			_ = FS.Rename(old, dest)
+		}
+		return nil, err
+	}
+	if err := FixOwnership(dest); err != nil {
+		Log.Warn("Failed to fix ownership of", dest+":", err)
+	}
+
+	rel, err := path.Rel(di.path, di.appPath)
+	if err != nil {
+		return nil, err
+	}
+	return &DiscordInstall{
+		path:             dest,
+		branch:           di.branch,
+		appPath:          path.Join(dest, rel),
+		isPatched:        di.isPatched,
+		isSystemElectron: di.isSystemElectron,
+	}, nil
+}
+
+// mkdirAllOwned is FS.MkdirAll, giving the directories it creates to the user
+// who ran us with sudo instead of leaving them to root
+func mkdirAllOwned(dir string) error {
+	created := ""
+	for p := path.Clean(dir); !ExistsFile(p) && path.Dir(p) != p; p = path.Dir(p) {
+		created = p
+	}
+	if err := FS.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if created != "" {
+		_ = FixOwnership(created)
+	}
+	return nil
+}
+
+// IsCopyOf returns whether dir was made by CopyTo from source
+func IsCopyOf(dir, source string) bool {
+	b, err := FS.ReadFile(path.Join(dir, copyMarker))
+	return err == nil && path.Clean(string(b)) == path.Clean(source)
+}
+
+func isUnderDir(p, dir string) bool {
+	rel, err := path.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// copyDir copies the directory src to dst, following symlinks
+func copyDir(src, dst string) error {
+	info, err := FS.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err = FS.MkdirAll(dst, info.Mode().Perm()|0700); err != nil {
+		return err
+	}
+
+	entries, err := FS.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		from, to := path.Join(src, e.Name()), path.Join(dst, e.Name())
+		info, err := FS.Stat(from)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			err = copyDir(from, to)
+		} else {
+			err = copyFile(from, to, info.Mode().Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := FS.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := FS.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	// Files of read-only installs are read-only too, but the copy is ours
+	return FS.Chmod(dst, perm|0600)
+}
@@ -0,0 +1,179 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	path "path/filepath"
+	"strings"
+)
+
+// CopyReadOnly copies di, a snap or a Nix store install, to ~/.local/share
+// where it can be patched, and where FindDiscords finds it as a regular
+// install from then on. Running it again refreshes the copy, for instance
+// after the snap or the package updated
+func CopyReadOnly(di *DiscordInstall) (*DiscordInstall, error) {
+	if !di.readOnly() {
+		return nil, errors.New(di.path + " is not read-only, patch it in place")
+	}
+	return PortableCopy(di, path.Join(Home, ".local/share", path.Base(di.path)))
+}
+
+// PortableCopy copies di to dest, where it can be patched without touching
+// di, and writes a launcher script and a desktop entry starting the copy.
+// Whatever installed di keeps updating it, the copy is refreshed by copying
+// again
+func PortableCopy(di *DiscordInstall, dest string) (*DiscordInstall, error) {
+	switch {
+	case di.isFlatpak:
+		return nil, errors.New(di.path + " is a flatpak, which only runs in its sandbox. Copies of it don't")
+	case di.isSystemElectron:
+		return nil, errors.New(di.path + " runs on the electron of the system, whose launcher only starts the original")
+	}
+
+	dest, err := path.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	copied, err := di.CopyTo(dest)
+	if err != nil {
+		return nil, err
+	}
+	if di.isNix {
+		if err = relocateNixWrappers(realPath(di.path), copied.path); err != nil {
+			return nil, err
+		}
+		if err = addNixGCRoot(realPath(di.path), copied.path); err != nil {
+			Log.Warn("Failed to add a garbage collector root for", di.path+":", err)
+			Log.Warn("The copy still loads libraries from the Nix store, which nix-collect-garbage may delete once Discord is updated. Copy it again if it stops starting")
+		}
+	}
+
+	launcher, err := writeLauncher(copied)
+	if err != nil {
+		Log.Warn("Failed to write a launcher for", copied.path+":", err)
+		return copied, nil
+	}
+	Log.Info("Start the copy with", launcher, "instead of", di.path)
+	if entry, err := writeDesktopEntry(copied, launcher); err != nil {
+		Log.Warn("Failed to write a desktop entry for", copied.path+":", err)
+	} else {
+		Log.Info("Added", entry, "to the applications")
+	}
+	return copied, nil
+}
+
+// Size above which a file can't be one of the wrapper scripts of nixpkgs
+const maxWrapperSize = 1 << 20
+
+// relocateNixWrappers makes the wrapper scripts copied from the store path src
+// to dest run what is in dest. nixpkgs wraps the binaries of Discord in
+// scripts setting up its libraries, which exec the real binary by its path in
+// the store. Left as is, the copy would run Discord from the store, unpatched
+func relocateNixWrappers(src, dest string) error {
+	entries, err := FS.ReadDir(dest)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxWrapperSize {
+			continue
+		}
+		p := path.Join(dest, e.Name())
+		b, err := FS.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(b, []byte("#!")) || !bytes.Contains(b, []byte(src)) {
+			continue
+		}
+		Log.Debug("Pointing the wrapper", p, "at", dest)
+		if err = FS.WriteFile(p, bytes.ReplaceAll(b, []byte(src), []byte(dest)), info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addNixGCRoot keeps the store path of src alive as long as the copy at dest
+// exists, as the relocated wrappers still load its libraries and those of its
+// dependencies from the store. The root is a symlink in dest, gone with it
+func addNixGCRoot(src, dest string) error {
+	rel, err := path.Rel(nixStore, src)
+	if err != nil {
+		return err
+	}
+	storePath := path.Join(nixStore, strings.SplitN(rel, "/", 2)[0])
+	return Exec.Run("nix-store", "--add-root", path.Join(dest, ".bashcord-gcroot"), "--realise", storePath)
+}
+
+// launcherName is the name of the launcher and desktop entry of the copy di
+func launcherName(di *DiscordInstall) string {
+	return strings.ReplaceAll(strings.ToLower(path.Base(di.path)), " ", "-") + "-bashcord"
+}
+
+// writeLauncher writes a script starting di to ~/.local/bin and returns it
+func writeLauncher(di *DiscordInstall) (string, error) {
+	bin := discordBinary(di)
+	if bin == "" {
+		return "", errors.New("Found no Discord binary to launch in " + di.path)
+	}
+	dir := path.Join(Home, ".local/bin")
+	if err := mkdirAllOwned(dir); err != nil {
+		return "", err
+	}
+	launcher := path.Join(dir, launcherName(di))
+	script := "#!/bin/sh\n# Starts the copy of Discord patched by Bashcord\nexec " + shellQuote([]string{bin}) + " \"$@\"\n"
+	if err := FS.WriteFile(launcher, []byte(script), 0755); err != nil {
+		return "", err
+	}
+	_ = FixOwnership(launcher)
+	return launcher, nil
+}
+
+// writeDesktopEntry adds the copy di, started by launcher, to the applications
+// of the user and returns its desktop entry
+func writeDesktopEntry(di *DiscordInstall, launcher string) (string, error) {
+	dir := path.Join(Home, ".local/share/applications")
+	if err := mkdirAllOwned(dir); err != nil {
+		return "", err
+	}
+
+	//goland:noinspection GoDeprecation
+	name := "Discord" + Ternary(di.branch == "stable", "", " "+strings.Title(di.branch))
+	// The tarballs ship their icon, packages put it elsewhere
+	icon := "discord"
+	if p := path.Join(di.path, "discord.png"); ExistsFile(p) {
+		icon = p
+	}
+	entry := path.Join(dir, launcherName(di)+".desktop")
+	contents := "[Desktop Entry]\n" +
+		"Type=Application\n" +
+		"Name=" + name + " (Bashcord)\n" +
+		"Comment=Copy of Discord patched by Bashcord, in " + di.path + "\n" +
+		"Exec=" + desktopQuote(launcher) + " %U\n" +
+		"Icon=" + icon + "\n" +
+		"Terminal=false\n" +
+		"Categories=Network;InstantMessaging;\n" +
+		"StartupWMClass=discord\n"
+	if err := FS.WriteFile(entry, []byte(contents), 0644); err != nil {
+		return "", err
+	}
+	_ = FixOwnership(entry)
+	return entry, nil
+}
+
+// desktopQuote quotes s for the Exec key of a desktop entry
+func desktopQuote(s string) string {
+	if strings.ContainsAny(s, " \t\"'\\$`<>~|&;*?#()") {
+		s = `"` + strings.NewReplacer(`\`, `\\\\`, `"`, `\\"`, "`", "\\\\`", "$", `\\$`).Replace(s) + `"`
+	}
+	// Field codes like %U are expanded in quotes too
+	return strings.ReplaceAll(s, "%", "%%")
+}
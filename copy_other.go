@@ -0,0 +1,23 @@
+//go:build !linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import "errors"
+
+// CopyReadOnly copies a read-only install somewhere writable. Only snaps and
+// the Nix store are read-only, which aren't looked for here
+func CopyReadOnly(di *DiscordInstall) (*DiscordInstall, error) {
+	return nil, errors.New(di.path + " is not read-only, patch it in place")
+}
+
+// PortableCopy copies di to dest to patch it there. Discord updates itself in
+// place here, so only Linux has installs worth copying
+func PortableCopy(di *DiscordInstall, _ string) (*DiscordInstall, error) {
+	return nil, errors.New("Patching a copy of " + di.path + " is only supported on Linux")
+}
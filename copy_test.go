@@ -0,0 +1,250 @@
+//go:build linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	path "path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCopyTo(t *testing.T) {
+	fx := newFixture(t)
+	di := fx.parse(fx.SystemElectron("/usr/lib/discord"))
+	// Not ours, whatever their names
+	fx.fs.mkfile("/opt/discord-copy.tmp/notes", []byte("mine"))
+	fx.fs.mkfile("/opt/discord-copy.old/notes", []byte("mine"))
+
+	copied, err := di.CopyTo("/opt/discord-copy")
+	fx.must(err)
+	if copied.path != "/opt/discord-copy" || copied.patchDir() != "/opt/discord-copy" || !copied.isSystemElectron {
+		t.Errorf("copy is %+v", copied)
+	}
+	fx.assertAsar("/opt/discord-copy/app.asar", fx.read("/usr/lib/discord/app.asar"))
+	fx.assertExists("/opt/discord-copy/app.asar.unpacked/discord_native.node", true)
+	if !IsCopyOf("/opt/discord-copy", di.path) {
+		t.Error("copy isn't marked as a copy")
+	}
+
+	// Copying again replaces the copy, with what changed since
+	fx.fs.mkfile("/usr/lib/discord/app.asar", discordAsar("updated"))
+	_, err = di.CopyTo("/opt/discord-copy")
+	fx.must(err)
+	fx.assertAsar("/opt/discord-copy/app.asar", discordAsar("updated"))
+
+	// Nothing left behind, nothing else removed
+	entries, err := fx.fs.ReadDir("/opt")
+	fx.must(err)
+	names := strings.Join(SliceMap(entries, func(e os.DirEntry) string { return e.Name() }), " ")
+	if names != "discord-copy discord-copy.old discord-copy.tmp" {
+		t.Errorf("/opt holds %s", names)
+	}
+	for _, notes := range []string{"/opt/discord-copy.tmp/notes", "/opt/discord-copy.old/notes"} {
+		if string(fx.read(notes)) != "mine" {
+			t.Errorf("%s changed", notes)
+		}
+	}
+}
+
+func TestCopyToRefusesToOverwrite(t *testing.T) {
+	fx := newFixture(t)
+	di := fx.parse(fx.Normal("/opt/discord"))
+	other := fx.Normal("/opt/DiscordCanary")
+
+	for _, dest := range []string{other, "/opt/discord/resources/copy"} {
+		if _, err := di.CopyTo(dest); err == nil {
+			t.Errorf("CopyTo(%s) succeeded", dest)
+		}
+	}
+	fx.assertAsar(path.Join(other, "resources", "app.asar"), discordAsar(other))
+	fx.assertExists("/opt/discord/resources/copy", false)
+}
+
+func TestReadOnlyInstalls(t *testing.T) {
+	for name, layout := range map[string]func(fx *fixture) string{
+		"snap": func(fx *fixture) string { return fx.Snap("discord") },
+		"nix":  func(fx *fixture) string { return fx.Nix("Discord") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			fx := newFixture(t)
+			di := fx.parse(layout(fx))
+			original := fx.read(path.Join(di.patchDir(), "app.asar"))
+
+			for name, change := range map[string]func() error{
+				"patch":            di.patch,
+				"unpatch":          di.unpatch,
+				"install openasar": di.InstallOpenAsar,
+			} {
+				if err := change(); !errors.Is(err, ErrReadOnlyInstall) {
+					t.Errorf("%s: err = %v, want %v", name, err, ErrReadOnlyInstall)
+				}
+			}
+			fx.assertAsar(path.Join(di.patchDir(), "app.asar"), original)
+			fx.assertExists(path.Join(di.patchDir(), "_app.asar"), false)
+		})
+	}
+}
+
+func TestCopyReadOnly(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout func(fx *fixture) string
+		// copy is where the copy goes and bin the binary the launcher starts
+		copy, bin string
+	}{
+		{
+			name:   "snap",
+			layout: func(fx *fixture) string { return fx.Snap("discord") },
+			copy:   fixtureHome + "/.local/share/discord",
+			bin:    "Discord",
+		},
+		{
+			name:   "nix",
+			layout: func(fx *fixture) string { return fx.Nix("DiscordCanary") },
+			copy:   fixtureHome + "/.local/share/DiscordCanary",
+			bin:    "DiscordCanary",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fx := newFixture(t)
+			oldHome := Home
+			t.Cleanup(func() { Home = oldHome })
+			Home = fixtureHome
+
+			di := fx.parse(tt.layout(fx))
+			original := fx.read(path.Join(di.patchDir(), "app.asar"))
+
+			copied, err := CopyReadOnly(di)
+			fx.must(err)
+			if copied.path != tt.copy || copied.readOnly() {
+				t.Fatalf("copy is %+v", copied)
+			}
+			fx.must(copied.patch())
+			fx.assertStub(path.Join(copied.patchDir(), "app.asar"), fixtureBashcord)
+			fx.assertAsar(path.Join(copied.patchDir(), "_app.asar"), original)
+
+			// The original is left alone, and the copy is found as a patched install
+			fx.assertAsar(path.Join(di.patchDir(), "app.asar"), original)
+			if !fx.parse(copied.path).isPatched {
+				t.Error("copy isn't patched once parsed again")
+			}
+
+			launcher := string(fx.read(fixtureHome + "/.local/bin/" + strings.ToLower(tt.bin) + "-bashcord"))
+			if !strings.Contains(launcher, "exec '"+path.Join(tt.copy, tt.bin)+"' \"$@\"") {
+				t.Errorf("launcher is %q", launcher)
+			}
+			// The wrapper of nixpkgs must run the binary of the copy
+			if wrapper := string(fx.read(path.Join(tt.copy, tt.bin))); strings.Contains(wrapper, di.path) {
+				t.Errorf("wrapper still runs the original: %q", wrapper)
+			}
+			// And the libraries it loads from the store must stay there
+			gcRoot := "nix-store --add-root " + tt.copy + "/.bashcord-gcroot --realise /nix/store/0123456789abcdfghijklmnpqrsvwxyz-discordcanary-0.0.50"
+			if di.isNix && !SliceContains(fx.exec.runs, gcRoot) {
+				t.Errorf("ran %q, want %q", fx.exec.runs, gcRoot)
+			}
+		})
+	}
+}
+
+func TestPortableCopy(t *testing.T) {
+	fx := newFixture(t)
+	oldHome := Home
+	t.Cleanup(func() { Home = oldHome })
+	Home = fixtureHome
+
+	di := fx.parse(fx.Normal("/usr/share/discord-canary"))
+	fx.must(fx.fs.WriteFile("/usr/share/discord-canary/DiscordCanary", []byte("\x7fELF"), 0755))
+	fx.must(fx.fs.WriteFile("/usr/share/discord-canary/discord.png", []byte("png"), 0644))
+	original := fx.read(path.Join(di.patchDir(), "app.asar"))
+
+	copied, err := PortableCopy(di, fixtureHome+"/Portable Discord")
+	fx.must(err)
+	fx.must(copied.patch())
+	fx.assertStub(path.Join(copied.patchDir(), "app.asar"), fixtureBashcord)
+	fx.assertAsar(path.Join(di.patchDir(), "app.asar"), original)
+	if copied.branch != "canary" {
+		t.Errorf("branch of the copy = %s", copied.branch)
+	}
+
+	launcher := fixtureHome + "/.local/bin/portable-discord-bashcord"
+	if script := string(fx.read(launcher)); !strings.Contains(script, "exec '"+fixtureHome+"/Portable Discord/DiscordCanary' \"$@\"") {
+		t.Errorf("launcher is %q", script)
+	}
+	entry := string(fx.read(fixtureHome + "/.local/share/applications/portable-discord-bashcord.desktop"))
+	for _, want := range []string{
+		"Name=Discord Canary (Bashcord)\n",
+		"Exec=" + launcher + " %U\n",
+		"Icon=" + fixtureHome + "/Portable Discord/discord.png\n",
+	} {
+		if !strings.Contains(entry, want) {
+			t.Errorf("desktop entry lacks %q:\n%s", want, entry)
+		}
+	}
+
+	for _, layout := range []func() string{
+		func() string { return fx.Flatpak("Discord", true) },
+		func() string { return fx.SystemElectron("/usr/lib/discord") },
+	} {
+		di := fx.parse(layout())
+		if _, err := PortableCopy(di, "/opt/copy"); err == nil {
+			t.Errorf("copied %s, which can't run from elsewhere", di.path)
+		}
+	}
+	fx.assertExists("/opt/copy", false)
+}
+
+func TestDesktopQuote(t *testing.T) {
+	for s, want := range map[string]string{
+		"/home/user/.local/bin/discord-bashcord": "/home/user/.local/bin/discord-bashcord",
+		"/home/John Doe/bin/discord":             `"/home/John Doe/bin/discord"`,
+		`/home/$USER/"quoted"\dir`:               `"/home/\\$USER/\\"quoted\\"\\\\dir"`,
+		"/home/user/100%/discord":                "/home/user/100%%/discord",
+		"/home/John Doe/%U":                      `"/home/John Doe/%%U"`,
+	} {
+		if got := desktopQuote(s); got != want {
+			t.Errorf("desktopQuote(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestPortableCopyOwnership(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Only root gives files to the user who ran sudo")
+	}
+	u, err := user.Lookup(os.Getenv("SUDO_USER"))
+	if err != nil || u.Uid == "0" {
+		t.Skip("No user to give files to")
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+
+	fx := newFixture(t)
+	oldHome := Home
+	t.Cleanup(func() { Home = oldHome })
+	Home = fixtureHome
+	di := fx.parse(fx.Normal("/usr/share/discord"))
+	fx.must(fx.fs.WriteFile("/usr/share/discord/Discord", []byte("\x7fELF"), 0755))
+
+	_, err = PortableCopy(di, fixtureHome+"/apps/Discord")
+	fx.must(err)
+	for _, dir := range []string{"apps", ".local", ".local/bin", ".local/share", ".local/share/applications"} {
+		if owner := fx.fs.files[path.Join(fixtureHome, dir)].uid; owner != uid {
+			t.Errorf("%s is owned by %d, want %d", dir, owner, uid)
+		}
+	}
+	// Only what the copy created
+	if owner := fx.fs.files[fixtureHome].uid; owner != 0 {
+		t.Errorf("%s given to %d", fixtureHome, owner)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const downloadAttempts = 3
+
+// partInfo is stored next to a partial download to make sure we only resume
+// it from the same file
+type partInfo struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// DownloadAndReplace downloads url to dest without ever leaving a partially
+// written dest behind: the file is downloaded to dest.part, resuming an earlier
+// partial download if possible, checked with verify and only then renamed into
+// place. The previous dest is kept as dest.prev.
+func DownloadAndReplace(url, dest string, verify func(file, sha256Hex string) error) error {
+	part := dest + ".part"
+
+	var err error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		if err = downloadPart(url, part); err == nil {
+			break
+		}
+		Log.Warn("Download of", url, "failed (attempt", strconv.Itoa(attempt)+"/"+strconv.Itoa(downloadAttempts)+"):", err)
+		if attempt < downloadAttempts {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	sum, err := hashFile(part)
+	if err != nil {
+		return err
+	}
+	if err = verify(part, sum); err != nil {
+		// No point in resuming a corrupt download
+		removePart(part)
+		return err
+	}
+
+	if err = keepPrevious(dest); err != nil {
+		Log.Warn("Failed to keep previous version of", dest+":", err)
+	}
+
+	Log.Debug("Renaming", part, "to", dest)
+	if err = os.Rename(part, dest); err != nil {
+		return fmt.Errorf("Failed to replace %s: %w", dest, err)
+	}
+	_ = os.Remove(part + ".json")
+	return nil
+}
+
+func downloadPart(url, part string) error {
+	info := partInfo{URL: url}
+
+	var offset int64
+	if stat, err := os.Stat(part); err == nil {
+		var saved partInfo
+		if b, err := os.ReadFile(part + ".json"); err == nil && json.Unmarshal(b, &saved) == nil && saved.URL == url {
+			offset = stat.Size()
+			info = saved
+		}
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	if offset > 0 {
+		Log.Debug("Resuming download of", url, "at", offset, "bytes")
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		// Makes the server send the whole file instead if it changed in the meantime
+		if validator := Ternary(info.ETag != "", info.ETag, info.LastModified); validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+
+	res, err := httpClient(url).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	switch {
+	case res.StatusCode == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(res.Header.Get("Content-Range"), "bytes "+strconv.FormatInt(offset, 10)+"-") {
+			removePart(part)
+			return errors.New("Server sent unexpected range " + res.Header.Get("Content-Range"))
+		}
+		flags |= os.O_APPEND
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The part is at least as large as the file, so it isn't a part of it
+		Log.Debug("Server can't resume", url, "at", offset, "bytes, starting over")
+		removePart(part)
+		return downloadPart(url, part)
+	case res.StatusCode < 300:
+		flags |= os.O_TRUNC
+		offset = 0
+		info = partInfo{URL: url, ETag: res.Header.Get("ETag"), LastModified: res.Header.Get("Last-Modified")}
+	default:
+		return errors.New(res.Status)
+	}
+
+	if b, err := json.Marshal(info); err == nil {
+		_ = os.WriteFile(part+".json", b, 0644)
+	}
+
+	out, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to create %s: %w", part, err)
+	}
+	defer out.Close()
+
+	read, err := io.Copy(out, res.Body)
+	if err != nil {
+		return fmt.Errorf("Download interrupted after %d bytes, it will be resumed: %w", offset+read, err)
+	}
+	if contentLength := res.ContentLength; contentLength >= 0 && read != contentLength {
+		return errors.New("Unexpected end of input. Content-Length was " + strconv.FormatInt(contentLength, 10) + ", but I only read " + strconv.FormatInt(read, 10))
+	}
+	return out.Close()
+}
+
+func removePart(part string) {
+	_ = os.Remove(part)
+	_ = os.Remove(part + ".json")
+}
+
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// keepPrevious makes dest.prev a copy of dest, leaving dest in place so it
+// can be replaced atomically afterwards
+func keepPrevious(dest string) error {
+	stat, err := os.Stat(dest)
+	if err != nil || !stat.Mode().IsRegular() {
+		return nil
+	}
+
+	prev := dest + ".prev"
+	if err = os.Remove(prev); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if os.Link(dest, prev) == nil {
+		return nil
+	}
+
+	in, err := os.Open(dest)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(prev)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err = io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
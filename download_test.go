@@ -0,0 +1,151 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	path "path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// downloadServer serves contents with etag, honouring Range and If-Range, and
+// records the Range header of every request
+type downloadServer struct {
+	*httptest.Server
+	contents []byte
+	etag     string
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func newDownloadServer(t *testing.T, contents, etag string) *downloadServer {
+	s := &downloadServer{contents: []byte(contents), etag: etag}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.mu.Unlock()
+		w.Header().Set("ETag", s.etag)
+		http.ServeContent(w, r, "desktop.asar", time.Time{}, bytes.NewReader(s.contents))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// verifySum is a verify func for DownloadAndReplace expecting contents
+func verifySum(contents string) func(string, string) error {
+	sum := sha256.Sum256([]byte(contents))
+	return func(_, sha256Hex string) error {
+		if sha256Hex != hex.EncodeToString(sum[:]) {
+			return ErrChecksumMismatch
+		}
+		return nil
+	}
+}
+
+// writePart leaves a partial download of url behind, as an interrupted
+// download of the file with etag would
+func writePart(t *testing.T, dest, url, etag, contents string) {
+	t.Helper()
+	b, _ := json.Marshal(partInfo{URL: url, ETag: etag})
+	if err := os.WriteFile(dest+".part.json", b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dest+".part", []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertFile(t *testing.T, name, want string) {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want {
+		t.Errorf("%s = %q, want %q", name, b, want)
+	}
+}
+
+func assertNoPart(t *testing.T, dest string) {
+	t.Helper()
+	for _, p := range []string{dest + ".part", dest + ".part.json"} {
+		if _, err := os.Stat(p); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s left behind", p)
+		}
+	}
+}
+
+func TestDownloadAndReplace(t *testing.T) {
+	const contents = "the new desktop.asar"
+
+	tests := []struct {
+		name string
+		// part is what an earlier download left, if anything
+		part, partETag string
+		wantRanges     []string
+	}{
+		{name: "fresh", wantRanges: []string{""}},
+		{name: "resume", part: contents[:8], partETag: `"v1"`, wantRanges: []string{"bytes=8-"}},
+		// The file changed since, If-Range makes the server send all of it
+		{name: "changed", part: "the old ", partETag: `"v0"`, wantRanges: []string{"bytes=8-"}},
+		// More than there is to download, so not a part of this file
+		{name: "too long", part: contents + "and then some", partETag: `"v1"`, wantRanges: []string{"bytes=33-", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newDownloadServer(t, contents, `"v1"`)
+			dest := path.Join(t.TempDir(), "desktop.asar")
+			if tt.part != "" {
+				writePart(t, dest, srv.URL, tt.partETag, tt.part)
+			}
+
+			if err := DownloadAndReplace(srv.URL, dest, verifySum(contents)); err != nil {
+				t.Fatal(err)
+			}
+			assertFile(t, dest, contents)
+			assertNoPart(t, dest)
+			if strings.Join(srv.ranges, ",") != strings.Join(tt.wantRanges, ",") {
+				t.Errorf("requested ranges %q, want %q", srv.ranges, tt.wantRanges)
+			}
+		})
+	}
+}
+
+func TestDownloadAndReplaceKeepsPrevious(t *testing.T) {
+	srv := newDownloadServer(t, "new", `"v1"`)
+	dest := path.Join(t.TempDir(), "desktop.asar")
+	if err := os.WriteFile(dest, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DownloadAndReplace(srv.URL, dest, verifySum("new")); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, dest, "new")
+	assertFile(t, dest+".prev", "old")
+
+	// A download failing verification replaces nothing and isn't resumed
+	srv.contents = []byte("evil")
+	if err := DownloadAndReplace(srv.URL, dest, verifySum("newer")); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("DownloadAndReplace() = %v, want %v", err, ErrChecksumMismatch)
+	}
+	assertFile(t, dest, "new")
+	assertFile(t, dest+".prev", "old")
+	assertNoPart(t, dest)
+}
@@ -8,6 +8,7 @@ package main
 
 import (
 	"os"
+	"os/exec"
 	path "path/filepath"
 	"strings"
 )
@@ -59,11 +60,22 @@ func FindDiscords() []any {
 			}
 		}
 	}
+	attachPendingJournals(discords)
 	return discords
 }
 
 func PreparePatch(di *DiscordInstall) {}
 
+// DiscordRunning returns false, PreparePatch leaves Discord running anyway
+func DiscordRunning(_ *DiscordInstall) bool {
+	return false
+}
+
+// launchCommand returns the command starting di, detached from us
+func launchCommand(di *DiscordInstall) (*exec.Cmd, error) {
+	return exec.Command("open", di.path), nil
+}
+
 func FixOwnership(_ string) error {
 	return nil
 }
@@ -10,10 +10,12 @@ import (
 	"errors"
 	"io/fs"
 	"os"
+	"os/exec"
 	"os/user"
 	path "path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 var (
@@ -54,33 +56,66 @@ func init() {
 	DiscordDirs = []string{
 		"/AppImages",
 		"/usr/share",
+		"/usr/local/share",
 		"/usr/lib64",
 		"/opt",
+		"/home/linuxbrew/.linuxbrew/opt",
 		path.Join(Home, "/Applications"),
 		path.Join(Home, ".local/share"),
 		path.Join(Home, ".local/bin"),
 		path.Join(Home, ".dvm"),
+		path.Join(Home, ".nix-profile/opt"),
+		"/run/current-system/sw/opt",
+		path.Join(Home, "apps"),
 		"/var/lib/flatpak/app",
 		path.Join(Home, "/.local/share/flatpak/app"),
+		snapDir,
 	}
 }
 
+// nixpkgs installs Discord to <store path>/opt/<binary name>, which profiles
+// like ~/.nix-profile or those of NixOS link to
+const nixStore = "/nix/store"
+
+// Snaps are mounted read-only in /snap/<name>/<revision>, with current linking
+// to the revision in use. Discord is in usr/share/<name> of it
+const snapDir = "/snap"
+
 func ParseDiscord(p, _ string) *DiscordInstall {
 	name := path.Base(p)
 
-	needsFlatpakResolve := strings.Contains(p, "/flatpak/") && !strings.Contains(p, "/current/active/files/")
+	// Only the apps themselves, anything else under a flatpak dir is parsed as is
+	needsFlatpakResolve := strings.Contains(p, "/flatpak/") && !strings.Contains(p, "/current/active/files/") &&
+		strings.HasPrefix(name, "com.discordapp.")
 	if needsFlatpakResolve {
-		discordName := strings.ToLower(name[len("com.discordapp."):])
-		if discordName != "discord" { //
+		discordName := strings.ToLower(strings.TrimPrefix(name, "com.discordapp."))
+		if discordName != "discord" && strings.HasPrefix(discordName, "discord") {
 			// DiscordCanary -> discord-canary
 			discordName = discordName[:7] + "-" + discordName[7:]
 		}
 		p = path.Join(p, "current/active/files", discordName)
 	}
 
+	isSnap := strings.HasPrefix(p, snapDir+"/")
+	if isSnap && path.Dir(p) == snapDir {
+		p = path.Join(p, "current/usr/share", name)
+	}
+
 	resources := path.Join(p, "resources")
 	app := path.Join(resources, "app")
 
+	branch := GetBranch(name)
+	// Tarballs may be unpacked under any name, but Discord knows its branch
+	if branch == "stable" && !strings.HasSuffix(strings.ToLower(name), "discord") {
+		buildInfo := ReadBuildInfo(resources)
+		if buildInfo == nil {
+			buildInfo = ReadBuildInfo(p)
+		}
+		if buildInfo != nil && SliceContains(branches, buildInfo.ReleaseChannel) {
+			branch = buildInfo.ReleaseChannel
+		}
+	}
+
 	isPatched, isSystemElectron := false, false
 
 	if ExistsFile(resources) { // normal install
@@ -95,43 +130,192 @@ func ParseDiscord(p, _ string) *DiscordInstall {
 
 	return &DiscordInstall{
 		path:             p,
-		branch:           GetBranch(name),
+		branch:           branch,
 		appPath:          app,
 		isPatched:        isPatched,
 		isFlatpak:        needsFlatpakResolve,
+		isSnap:           isSnap,
+		isNix:            strings.HasPrefix(realPath(p), nixStore+"/"),
 		isSystemElectron: isSystemElectron,
 	}
 }
 
+// realPath returns p with its symlinks resolved, or p if that fails
+func realPath(p string) string {
+	if real, err := path.EvalSymlinks(p); err == nil {
+		return real
+	}
+	return p
+}
+
+// The binaries of each branch, as named by the various packages
+var linuxBinaryNames = map[string][]string{
+	"stable":      {"Discord", "discord"},
+	"ptb":         {"DiscordPTB", "discord-ptb", "discordptb"},
+	"canary":      {"DiscordCanary", "discord-canary", "discordcanary"},
+	"development": {"DiscordDevelopment", "discord-development", "discorddevelopment"},
+}
+
+// What a graphical app needs to reach the session of the user
+var sessionEnv = []string{"DISPLAY", "WAYLAND_DISPLAY", "XAUTHORITY", "XDG_RUNTIME_DIR", "DBUS_SESSION_BUS_ADDRESS"}
+
+// launchCommand returns the command starting di, detached from us
+func launchCommand(di *DiscordInstall) (*exec.Cmd, error) {
+	var args []string
+	if di.isFlatpak {
+		args = []string{"flatpak", "run", di.flatpakID()}
+	} else if bin := discordBinary(di); bin != "" {
+		args = []string{bin}
+	} else {
+		return nil, errors.New("Found no Discord binary to launch in " + di.path)
+	}
+
+	var cmd *exec.Cmd
+	if os.Getuid() == 0 && os.Getenv("SUDO_USER") != "" {
+		cmd = exec.Command("su", realUserArgs(shellQuote(args), sessionEnv...)...)
+	} else {
+		cmd = exec.Command(args[0], args[1:]...)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	return cmd, nil
+}
+
+// discordBinary returns the binary starting di. System electron installs are
+// only started by the launcher of their package, found in PATH
+func discordBinary(di *DiscordInstall) string {
+	for _, name := range linuxBinaryNames[di.branch] {
+		if di.isSystemElectron {
+			if bin, err := exec.LookPath(name); err == nil {
+				return bin
+			}
+			continue
+		}
+		bin := path.Join(di.path, name)
+		if s, err := FS.Stat(bin); err == nil && !s.IsDir() && s.Mode()&0111 != 0 {
+			return bin
+		}
+	}
+	return ""
+}
+
+// The deepest FindDiscords looks below a search directory
+const maxSearchDepth = 8
+
+// searchDirs returns the directories FindDiscords looks in and how deep.
+// Those of BASHCORD_SEARCH_PATHS, a list like PATH, come first, then those
+// of the config file, then DiscordDirs. The depth is --search-depth, else
+// BASHCORD_SEARCH_DEPTH, else the one of the config file, else 1
+func searchDirs() ([]string, int) {
+	config, err := ReadConfig()
+	if err != nil {
+		Log.Warn("Failed to read the search paths of the config:", err)
+		config = defaultConfig()
+	}
+
+	var dirs []string
+	if env := os.Getenv("BASHCORD_SEARCH_PATHS"); env != "" {
+		dirs = append(dirs, path.SplitList(env)...)
+	}
+	dirs = append(dirs, config.SearchPaths...)
+	dirs = SliceMap(dirs, expandHome)
+	dirs = append(dirs, DiscordDirs...)
+
+	depth := config.SearchDepth
+	if s := os.Getenv("BASHCORD_SEARCH_DEPTH"); s != "" {
+		if depth, err = strconv.Atoi(s); err != nil {
+			Log.Warn("Invalid search depth", s+", using 1")
+		}
+	}
+	if searchDepthArg != 0 {
+		depth = searchDepthArg
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	return dirs, min(depth, maxSearchDepth)
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		return path.Join(Home, p[1:])
+	}
+	return p
+}
+
 func FindDiscords() []any {
 	var discords []any
-	for _, dir := range DiscordDirs {
-		children, err := os.ReadDir(dir)
-		if err != nil {
-			if !errors.Is(err, os.ErrNotExist) {
-				Log.Warn("Error during readdir "+dir+":", err)
+	found := make(map[string]bool)
+	dirs, depth := searchDirs()
+	for _, dir := range dirs {
+		scanForDiscords(dir, depth, func(discordDir string) {
+			discord := ParseDiscord(discordDir, "")
+			if discord == nil || found[discord.path] {
+				return
 			}
-			continue
+			Log.Debug("Found Discord install at ", discordDir)
+			found[discord.path] = true
+			discords = append(discords, discord)
+		})
+	}
+
+	attachPendingJournals(discords)
+	return discords
+}
+
+// scanForDiscords calls found with the directories below dir, depth levels
+// deep at most, that look like a Discord install
+func scanForDiscords(dir string, depth int, found func(string)) {
+	children, err := FS.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			Log.Warn("Error during readdir "+dir+":", err)
 		}
+		return
+	}
 
-		for _, child := range children {
-			name := child.Name()
-			if !child.IsDir() || !SliceContains(LinuxDiscordNames, name) {
+	for _, child := range children {
+		name := child.Name()
+		p := path.Join(dir, name)
+		// Profiles like ~/.nix-profile link to their packages. Those are looked
+		// at but never walked into, symlinks may loop
+		isLink := child.Type()&fs.ModeSymlink != 0
+		if isLink {
+			if s, err := FS.Stat(p); err != nil || !s.IsDir() {
 				continue
 			}
+		} else if !child.IsDir() {
+			continue
+		}
 
-			discordDir := path.Join(dir, name)
-			if discord := ParseDiscord(discordDir, ""); discord != nil {
-				Log.Debug("Found Discord install at ", discordDir)
-				discords = append(discords, discord)
-			}
+		if SliceContains(LinuxDiscordNames, name) || looksLikeDiscord(p) {
+			found(p)
+		} else if depth > 1 && !isLink && !strings.HasPrefix(name, ".") {
+			scanForDiscords(p, depth-1, found)
 		}
 	}
-
-	return discords
 }
 
-func PreparePatch(di *DiscordInstall) {}
+// looksLikeDiscord returns whether dir is a Discord install, whatever its
+// name: it has an app.asar, and a build_info.json or a Discord binary next to
+// it. Other electron apps have the former but not the latter
+func looksLikeDiscord(dir string) bool {
+	for _, asarDir := range []string{path.Join(dir, "resources"), dir} {
+		if _, err := FS.Stat(path.Join(asarDir, "app.asar")); err != nil {
+			continue
+		}
+		if buildInfo := ReadBuildInfo(asarDir); buildInfo != nil && buildInfo.ReleaseChannel != "" {
+			return true
+		}
+		for _, names := range linuxBinaryNames {
+			for _, name := range names {
+				if s, err := FS.Stat(path.Join(dir, name)); err == nil && !s.IsDir() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
 
 // FixOwnership fixes file ownership on Linux
 func FixOwnership(p string) error {
@@ -157,9 +341,9 @@ func FixOwnership(p string) error {
 	uid, _ := strconv.Atoi(u.Uid)
 	gid, _ := strconv.Atoi(u.Gid)
 
-	err = path.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+	err = WalkDir(p, func(path string, d fs.DirEntry, err error) error {
 		if err == nil {
-			err = os.Chown(path, uid, gid)
+			err = FS.Chown(path, uid, gid)
 			Log.Debug("chown", u.Uid+":"+u.Gid, path+":", Ternary(err == nil, "Success!", "Failed"))
 		}
 		return err
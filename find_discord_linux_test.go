@@ -0,0 +1,224 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	path "path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDiscord(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout func(fx *fixture) string
+		// path is where the install ends up, if not where layout put it
+		path                                   string
+		branch                                 string
+		isPatched, isFlatpak, isSystemElectron bool
+		isSnap, isNix                          bool
+	}{
+		{
+			name:   "normal",
+			layout: func(fx *fixture) string { return fx.Normal("/opt/DiscordCanary") },
+			branch: "canary",
+		},
+		{
+			name:             "system electron",
+			layout:           func(fx *fixture) string { return fx.SystemElectron("/usr/lib/discord") },
+			branch:           "stable",
+			isSystemElectron: true,
+		},
+		{
+			name:      "flatpak user",
+			layout:    func(fx *fixture) string { return fx.Flatpak("Discord", false) },
+			path:      fixtureHome + "/.local/share/flatpak/app/com.discordapp.Discord/current/active/files/discord",
+			branch:    "stable",
+			isFlatpak: true,
+		},
+		{
+			name:      "flatpak system",
+			layout:    func(fx *fixture) string { return fx.Flatpak("DiscordCanary", true) },
+			path:      "/var/lib/flatpak/app/com.discordapp.DiscordCanary/current/active/files/discord-canary",
+			branch:    "canary",
+			isFlatpak: true,
+		},
+		{
+			name:   "snap",
+			layout: func(fx *fixture) string { return fx.Snap("discord-canary") },
+			path:   "/snap/discord-canary/current/usr/share/discord-canary",
+			branch: "canary",
+			isSnap: true,
+		},
+		{
+			name:   "snap given by its files",
+			layout: func(fx *fixture) string { return path.Join(fx.Snap("discord"), "current/usr/share/discord") },
+			branch: "stable",
+			isSnap: true,
+		},
+		{
+			name:   "nix",
+			layout: func(fx *fixture) string { return fx.Nix("DiscordCanary") },
+			branch: "canary",
+			isNix:  true,
+		},
+		{
+			name:      "patched",
+			layout:    func(fx *fixture) string { return fx.Patched(fx.Normal(fixtureHome + "/.local/share/DiscordPTB")) },
+			branch:    "ptb",
+			isPatched: true,
+		},
+		{
+			name:             "patched system electron",
+			layout:           func(fx *fixture) string { return fx.Patched(fx.SystemElectron("/usr/lib/discord")) },
+			branch:           "stable",
+			isPatched:        true,
+			isSystemElectron: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fx := newFixture(t)
+			dir := tt.layout(fx)
+			di := fx.parse(dir)
+
+			want := Ternary(tt.path != "", tt.path, dir)
+			if di.path != want {
+				t.Errorf("path = %s, want %s", di.path, want)
+			}
+			if di.branch != tt.branch {
+				t.Errorf("branch = %s, want %s", di.branch, tt.branch)
+			}
+			if di.isPatched != tt.isPatched || di.isFlatpak != tt.isFlatpak || di.isSystemElectron != tt.isSystemElectron {
+				t.Errorf("isPatched, isFlatpak, isSystemElectron = %v, %v, %v, want %v, %v, %v",
+					di.isPatched, di.isFlatpak, di.isSystemElectron, tt.isPatched, tt.isFlatpak, tt.isSystemElectron)
+			}
+			if di.isSnap != tt.isSnap || di.isNix != tt.isNix {
+				t.Errorf("isSnap, isNix = %v, %v, want %v, %v", di.isSnap, di.isNix, tt.isSnap, tt.isNix)
+			}
+		})
+	}
+}
+
+func TestParseDiscordInvalid(t *testing.T) {
+	fx := newFixture(t)
+	fx.fs.mkfile("/opt/discord/readme.txt", []byte("not discord"))
+
+	for _, dir := range []string{"/opt/discord", "/opt/nothing", "/var/lib/flatpak/app/x", "/var/lib/flatpak/app/com.discordapp.X"} {
+		if di := ParseDiscord(dir, ""); di != nil {
+			t.Errorf("ParseDiscord(%s) = %+v, want nil", dir, di)
+		}
+	}
+
+	// Not a flatpak, just under a directory named so
+	dir := fx.Normal("/home/user/flatpak/dc")
+	if di := ParseDiscord(dir, ""); di == nil || di.path != dir {
+		t.Errorf("ParseDiscord(%s) = %+v, want it as is", dir, di)
+	}
+}
+
+func TestFindDiscords(t *testing.T) {
+	fx := newFixture(t)
+	oldDirs := DiscordDirs
+	t.Cleanup(func() { DiscordDirs = oldDirs })
+	DiscordDirs = []string{"/opt", "/usr/lib", "/var/lib/flatpak/app", snapDir, "/missing"}
+
+	fx.Normal("/opt/discord-ptb")
+	fx.Patched(fx.SystemElectron("/usr/lib/discord"))
+	fx.Flatpak("Discord", true)
+	fx.Snap("discord")
+	fx.ElectronApp("/opt/element")
+	// A tarball unpacked under its own name is still found
+	fx.Normal("/opt/discord-0.0.50")
+
+	var found []string
+	for _, d := range FindDiscords() {
+		found = append(found, d.(*DiscordInstall).path)
+	}
+	want := []string{
+		"/opt/discord-0.0.50",
+		"/opt/discord-ptb",
+		"/usr/lib/discord",
+		path.Join("/var/lib/flatpak/app/com.discordapp.Discord/current/active/files/discord"),
+		"/snap/discord/current/usr/share/discord",
+	}
+	if len(found) != len(want) {
+		t.Fatalf("found %v, want %v", found, want)
+	}
+	for i := range want {
+		if found[i] != want[i] {
+			t.Errorf("found %v, want %v", found, want)
+		}
+	}
+}
+
+func TestFindDiscordsSearchPaths(t *testing.T) {
+	fx := newFixture(t)
+	oldDirs, oldHome := DiscordDirs, Home
+	t.Cleanup(func() { DiscordDirs, Home = oldDirs, oldHome })
+	DiscordDirs, Home = []string{"/opt"}, fixtureHome
+
+	fx.Normal("/opt/discord")
+	fx.Normal("/srv/discord-canary")
+	fx.Normal(fixtureHome + "/apps/chat/DiscordPTB")
+	fx.Normal("/mnt/tools/deep/down/discord")
+	fx.ElectronApp("/mnt/tools/element")
+	config, err := ReadConfig()
+	fx.must(err)
+	config.SearchPaths = []string{"~/apps"}
+	fx.must(config.Save())
+
+	tests := []struct {
+		name, paths, depth string
+		// flagDepth is --search-depth
+		flagDepth int
+		want      []string
+	}{
+		{
+			name: "config only",
+			want: []string{"/opt/discord"},
+		},
+		{
+			name:  "config deeper",
+			depth: "2",
+			want:  []string{fixtureHome + "/apps/chat/DiscordPTB", "/opt/discord"},
+		},
+		{
+			name:  "env first, without duplicates",
+			paths: "/srv:/mnt/tools:/opt",
+			depth: "3",
+			want:  []string{"/srv/discord-canary", "/mnt/tools/deep/down/discord", "/opt/discord", fixtureHome + "/apps/chat/DiscordPTB"},
+		},
+		{
+			name:  "depth bounded",
+			paths: "/mnt/tools",
+			depth: "2",
+			want:  []string{fixtureHome + "/apps/chat/DiscordPTB", "/opt/discord"},
+		},
+		{
+			name:      "flag over env",
+			paths:     "/mnt/tools",
+			depth:     "1",
+			flagDepth: 3,
+			want:      []string{"/mnt/tools/deep/down/discord", fixtureHome + "/apps/chat/DiscordPTB", "/opt/discord"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BASHCORD_SEARCH_PATHS", tt.paths)
+			t.Setenv("BASHCORD_SEARCH_DEPTH", tt.depth)
+			searchDepthArg = tt.flagDepth
+			t.Cleanup(func() { searchDepthArg = 0 })
+
+			found := SliceMap(FindDiscords(), func(d any) string { return d.(*DiscordInstall).path })
+			if strings.Join(found, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("found %v, want %v", found, tt.want)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"golang.org/x/sys/windows"
 	"os"
+	"os/exec"
 	path "path/filepath"
 	"strings"
 	"sync"
@@ -26,7 +27,7 @@ var windowsNames = map[string]string{
 var killLock sync.Mutex
 
 func ParseDiscord(p, branch string) *DiscordInstall {
-	entries, err := os.ReadDir(p)
+	entries, err := FS.ReadDir(p)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
 			Log.Warn("Error during readdir "+p+":", err)
@@ -84,9 +85,19 @@ func FindDiscords() []any {
 			discords = append(discords, discord)
 		}
 	}
+	attachPendingJournals(discords)
 	return discords
 }
 
+// launchCommand returns the command starting di, the way the shortcuts of Discord do
+func launchCommand(di *DiscordInstall) (*exec.Cmd, error) {
+	name, ok := windowsNames[di.branch]
+	if !ok {
+		name = "Discord"
+	}
+	return exec.Command(path.Join(di.path, "Update.exe"), "--processStart", name+".exe"), nil
+}
+
 func PreparePatch(di *DiscordInstall) {
 	killLock.Lock()
 	defer killLock.Unlock()
@@ -114,6 +125,11 @@ func PreparePatch(di *DiscordInstall) {
 	}
 }
 
+// DiscordRunning returns whether di is running
+func DiscordRunning(di *DiscordInstall) bool {
+	return findProcessIdByName(windowsNames[di.branch]+".exe") != 0
+}
+
 func FixOwnership(_ string) error {
 	return nil
 }
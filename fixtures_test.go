@@ -0,0 +1,290 @@
+//go:build linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	path "path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"vencord/asar"
+)
+
+const (
+	fixtureHome     = "/home/user"
+	fixtureBashcord = fixtureHome + "/.config/Bashcord/bashcord.asar"
+)
+
+// fixture swaps FS and Exec for in memory fakes for the duration of a test,
+// and builds fake Discord installs in them
+type fixture struct {
+	t    *testing.T
+	fs   *memFS
+	exec *fakeExec
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	oldFS, oldExec := FS, Exec
+	oldBaseDir, oldDirectory := BaseDir, EquicordDirectory
+	oldInstalled, oldLatest := InstalledHash, LatestHash
+	oldProcDir := procDir
+	t.Cleanup(func() {
+		FS, Exec = oldFS, oldExec
+		BaseDir, EquicordDirectory = oldBaseDir, oldDirectory
+		InstalledHash, LatestHash = oldInstalled, oldLatest
+		procDir = oldProcDir
+	})
+
+	fx := &fixture{t: t, fs: newMemFS(), exec: &fakeExec{}}
+	fx.exec.fs = fx.fs
+	FS, Exec = fx.fs, fx.exec
+	// No Discord is running, see fakeProcess
+	procDir = t.TempDir()
+
+	BaseDir = path.Dir(fixtureBashcord)
+	EquicordDirectory = fixtureBashcord
+	fx.fs.mkfile(EquicordDirectory, []byte("// Equicord 1a2b3c4\n"))
+	// Otherwise patch() would download Bashcord first
+	InstalledHash, LatestHash = "1a2b3c4", "1a2b3c4"
+	return fx
+}
+
+// discordAsar is the app.asar Discord ships, told apart by name
+func discordAsar(name string) []byte {
+	return makeAsar(`module.exports = "` + name + `"`)
+}
+
+var fakeOpenAsar = makeAsar(`// OpenAsar`)
+
+func makeAsar(indexJs string) []byte {
+	w := asar.NewWriter()
+	if err := w.AddBytes("index.js", []byte(indexJs), asar.FileOptions{}); err != nil {
+		panic(err)
+	}
+	if err := w.AddBytes("package.json", []byte(PackageJson), asar.FileOptions{}); err != nil {
+		panic(err)
+	}
+	b, err := w.Bytes()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Normal makes a regular install at dir, with its asar in resources
+func (fx *fixture) Normal(dir string) string {
+	fx.fs.mkfile(path.Join(dir, "resources", "app.asar"), discordAsar(dir))
+	fx.fs.mkfile(path.Join(dir, "resources", "build_info.json"), []byte(`{"releaseChannel":"stable","version":"0.0.50"}`))
+	return dir
+}
+
+// SystemElectron makes an install running on the system electron, like the
+// discord_arch_electron package: no resources folder and an unpacked dir
+func (fx *fixture) SystemElectron(dir string) string {
+	fx.fs.mkfile(path.Join(dir, "app.asar"), discordAsar(dir))
+	fx.fs.mkfile(path.Join(dir, "app.asar.unpacked", "discord_native.node"), []byte("native"))
+	return dir
+}
+
+// Flatpak makes a flatpak install of com.discordapp.<name>, in the system
+// installation or the one of the user. It returns the app dir, as found by
+// FindDiscords
+func (fx *fixture) Flatpak(name string, system bool) string {
+	app := path.Join(Ternary(system, "/var/lib/flatpak/app", fixtureHome+"/.local/share/flatpak/app"), "com.discordapp."+name)
+	discordName := strings.ToLower(name)
+	if discordName != "discord" {
+		discordName = discordName[:7] + "-" + discordName[7:]
+	}
+	fx.Normal(path.Join(app, "current/active/files", discordName))
+	return app
+}
+
+// ElectronApp makes an electron app that isn't Discord at dir
+func (fx *fixture) ElectronApp(dir string) string {
+	fx.fs.mkfile(path.Join(dir, "resources", "app.asar"), makeAsar(`// not Discord`))
+	fx.must(fx.fs.WriteFile(path.Join(dir, "element-desktop"), []byte("#!/bin/sh"), 0755))
+	return dir
+}
+
+// Snap makes the snap <name>, as mounted by snapd. It returns /snap/<name>,
+// as found by FindDiscords
+func (fx *fixture) Snap(name string) string {
+	dir := fx.Normal(path.Join("/snap", name, "current/usr/share", name))
+	bin := Ternary(name == "discord", "Discord", "DiscordCanary")
+	fx.must(fx.fs.WriteFile(path.Join(dir, bin), []byte("#!/bin/sh"), 0755))
+	return path.Join("/snap", name)
+}
+
+// Nix makes Discord as nixpkgs builds it, with the binary wrapped in a script
+// exec'ing it by its path in the store. It returns the install dir
+func (fx *fixture) Nix(name string) string {
+	dir := fx.Normal(path.Join("/nix/store/0123456789abcdfghijklmnpqrsvwxyz-"+strings.ToLower(name)+"-0.0.50/opt", name))
+	fx.must(fx.fs.WriteFile(path.Join(dir, "."+name+"-wrapped"), []byte("\x7fELF"), 0555))
+	wrapper := "#! /nix/store/aaaa-bash/bin/bash -e\n" +
+		"export LD_LIBRARY_PATH='/nix/store/bbbb-libs/lib':'" + dir + "'\n" +
+		"exec -a \"$0\" \"" + path.Join(dir, "."+name+"-wrapped") + "\" \"$@\"\n"
+	fx.must(fx.fs.WriteFile(path.Join(dir, name), []byte(wrapper), 0555))
+	return dir
+}
+
+// Patched patches the install at dir the way patch does, without going
+// through it
+func (fx *fixture) Patched(dir string) string {
+	di := ParseDiscord(dir, "")
+	if di == nil {
+		fx.t.Fatalf("No Discord install at %s to patch", dir)
+	}
+	pd := di.patchDir()
+	fx.must(fx.fs.Rename(path.Join(pd, "app.asar"), path.Join(pd, "_app.asar")))
+	if di.isSystemElectron {
+		fx.must(fx.fs.Rename(path.Join(pd, "app.asar.unpacked"), path.Join(pd, "_app.asar.unpacked")))
+	}
+	fx.must(WriteAppAsar(path.Join(pd, "app.asar"), EquicordDirectory))
+	return dir
+}
+
+func (fx *fixture) must(err error) {
+	fx.t.Helper()
+	if err != nil {
+		fx.t.Fatal(err)
+	}
+}
+
+// parse is ParseDiscord failing the test when dir isn't an install
+func (fx *fixture) parse(dir string) *DiscordInstall {
+	fx.t.Helper()
+	di := ParseDiscord(dir, "")
+	if di == nil {
+		fx.t.Fatalf("ParseDiscord(%s) = nil", dir)
+	}
+	return di
+}
+
+func (fx *fixture) read(name string) []byte {
+	fx.t.Helper()
+	b, err := fx.fs.ReadFile(name)
+	if err != nil {
+		fx.t.Fatal(err)
+	}
+	return b
+}
+
+func (fx *fixture) assertExists(name string, exists bool) {
+	fx.t.Helper()
+	if _, err := fx.fs.Stat(name); (err == nil) != exists {
+		fx.t.Errorf("%s exists = %v, want %v", name, err == nil, exists)
+	}
+}
+
+// assertAsar checks that name is the asar want
+func (fx *fixture) assertAsar(name string, want []byte) {
+	fx.t.Helper()
+	if b, err := fx.fs.ReadFile(name); err != nil {
+		fx.t.Error(err)
+	} else if !bytes.Equal(b, want) {
+		main, _ := ReadAsarMain(name)
+		fx.t.Errorf("%s is not the expected asar, its index.js is %q", name, main)
+	}
+}
+
+// assertStub checks that name is a stub app.asar loading target
+func (fx *fixture) assertStub(name, target string) {
+	fx.t.Helper()
+	if got, err := ReadAppAsarTarget(name); err != nil {
+		fx.t.Error(err)
+	} else if got != target {
+		fx.t.Errorf("%s loads %s, want %s", name, got, target)
+	}
+}
+
+// fakeExec records the commands run and serves downloads from downloads
+type fakeExec struct {
+	fs        *memFS
+	runs      []string
+	downloads map[string][]byte
+}
+
+func (e *fakeExec) Run(name string, args ...string) error {
+	e.runs = append(e.runs, strings.Join(Prepend(args, name), " "))
+	return nil
+}
+
+func (e *fakeExec) Download(url, dest string, verify func(file, sha256Hex string) error) error {
+	b, ok := e.downloads[url]
+	if !ok {
+		return fmt.Errorf("GET %s: 404 Not Found", url)
+	}
+	tmp := dest + ".download"
+	if err := e.fs.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(b)
+	if err := verify(tmp, hex.EncodeToString(sum[:])); err != nil {
+		_ = e.fs.Remove(tmp)
+		return err
+	}
+	return e.fs.Rename(tmp, dest)
+}
+
+func (e *fakeExec) Start(cmd *exec.Cmd) error {
+	e.runs = append(e.runs, "start "+strings.Join(cmd.Args, " "))
+	return nil
+}
+
+func (e *fakeExec) Terminate(pids []int, _ time.Duration) error {
+	e.runs = append(e.runs, "terminate "+strings.Join(SliceMap(pids, strconv.Itoa), " "))
+	return nil
+}
+
+var errInjected = errors.New("injected failure")
+
+// faultFS fails the renames in dir whose number, counting from 1, is in
+// failRenames and writes to files named failWrite
+type faultFS struct {
+	FileSystem
+	dir         string
+	renames     int
+	failRenames map[int]bool
+	failWrite   string
+}
+
+func (f *faultFS) Rename(from, to string) error {
+	if path.Dir(from) != f.dir {
+		return f.FileSystem.Rename(from, to)
+	}
+	f.renames++
+	if f.failRenames[f.renames] {
+		return fmt.Errorf("rename %s %s: %w", from, to, errInjected)
+	}
+	return f.FileSystem.Rename(from, to)
+}
+
+func (f *faultFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if f.failWrite != "" && path.Base(name) == f.failWrite {
+		return fmt.Errorf("write %s: %w", name, errInjected)
+	}
+	return f.FileSystem.WriteFile(name, data, perm)
+}
+
+// inject makes FS fail in dir as told by f until the test ends
+func (fx *fixture) inject(dir string, f *faultFS) {
+	f.FileSystem = fx.fs
+	f.dir = dir
+	FS = f
+}
@@ -0,0 +1,372 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	path "path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// FileSystem is what the installer reads and changes files through, instead
+// of calling os directly. StartDryRun swaps it for one that only records the
+// changes, tests for one in memory.
+type FileSystem interface {
+	Stat(name string) (os.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	ReadDir(name string) ([]os.DirEntry, error)
+	Open(name string) (ReadableFile, error)
+
+	Rename(from, to string) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	MkdirAll(name string, perm os.FileMode) error
+	Chmod(name string, mode os.FileMode) error
+	Chown(name string, uid, gid int) error
+	// WriteFile atomically replaces name with data, see WriteFileAtomic
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	// Create creates or truncates name
+	Create(name string) (WritableFile, error)
+	// CreateTemp creates a new file in dir, like os.CreateTemp
+	CreateTemp(dir, pattern string) (WritableFile, error)
+	// MkdirTemp creates a new directory in dir, like os.MkdirTemp
+	MkdirTemp(dir, pattern string) (string, error)
+}
+
+type ReadableFile interface {
+	io.ReadCloser
+	io.ReaderAt
+}
+
+type WritableFile interface {
+	io.WriteCloser
+	Name() string
+}
+
+// Executor runs everything that isn't a plain file operation
+type Executor interface {
+	// Run runs an external command with our stdout and stderr
+	Run(name string, args ...string) error
+	// Download replaces dest with the file at url, see DownloadAndReplace
+	Download(url, dest string, verify func(file, sha256Hex string) error) error
+	// Start starts cmd without waiting for it or keeping its output
+	Start(cmd *exec.Cmd) error
+	// Terminate sends SIGTERM to the processes, then SIGKILL to those still
+	// running after timeout, and waits for them to exit
+	Terminate(pids []int, timeout time.Duration) error
+}
+
+var FS FileSystem = osFileSystem{}
+var Exec Executor = osExecutor{}
+
+type osFileSystem struct{}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osFileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFileSystem) Open(name string) (ReadableFile, error) {
+	return os.Open(name)
+}
+
+func (osFileSystem) Rename(from, to string) error {
+	return os.Rename(from, to)
+}
+
+func (osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFileSystem) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (osFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+func (osFileSystem) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (osFileSystem) Chown(name string, uid, gid int) error {
+	return os.Chown(name, uid, gid)
+}
+
+func (osFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return WriteFileAtomic(name, data, perm)
+}
+
+func (osFileSystem) Create(name string) (WritableFile, error) {
+	return os.Create(name)
+}
+
+func (osFileSystem) CreateTemp(dir, pattern string) (WritableFile, error) {
+	return os.CreateTemp(dir, pattern)
+}
+
+func (osFileSystem) MkdirTemp(dir, pattern string) (string, error) {
+	return os.MkdirTemp(dir, pattern)
+}
+
+// WalkDir is filepath.WalkDir, reading through FS
+func WalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := FS.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkDir(p string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(p, d, nil); err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := FS.ReadDir(p)
+	if err != nil {
+		if err = fn(p, d, err); err != nil {
+			if err == fs.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, e := range entries {
+		if err = walkDir(path.Join(p, e.Name()), e, fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+type osExecutor struct{}
+
+func (osExecutor) Run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (osExecutor) Download(url, dest string, verify func(file, sha256Hex string) error) error {
+	return DownloadAndReplace(url, dest, verify)
+}
+
+func (osExecutor) Start(cmd *exec.Cmd) error {
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, nil, nil
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// How long Terminate waits for killed processes to go away
+const killWait = 5 * time.Second
+
+func (osExecutor) Terminate(pids []int, timeout time.Duration) error {
+	var procs []*os.Process
+	for _, pid := range pids {
+		p, err := os.FindProcess(pid)
+		if err != nil {
+			continue
+		}
+		if err = p.Signal(syscall.SIGTERM); err != nil {
+			if errors.Is(err, os.ErrProcessDone) {
+				continue
+			}
+			return fmt.Errorf("Failed to stop process %d: %w", pid, err)
+		}
+		procs = append(procs, p)
+	}
+
+	if procs = waitForExit(procs, timeout); len(procs) == 0 {
+		return nil
+	}
+	Log.Warn(len(procs), "process(es) still running", timeout, "after SIGTERM, killing them")
+	for _, p := range procs {
+		_ = p.Kill()
+	}
+	if procs = waitForExit(procs, killWait); len(procs) != 0 {
+		return fmt.Errorf("Failed to stop process %d, it is still running after SIGKILL", procs[0].Pid)
+	}
+	return nil
+}
+
+// waitForExit waits up to timeout for procs to exit and returns those still running
+func waitForExit(procs []*os.Process, timeout time.Duration) []*os.Process {
+	deadline := time.Now().Add(timeout)
+	for {
+		procs = SliceFilter(procs, func(p *os.Process) bool {
+			return p.Signal(syscall.Signal(0)) == nil
+		})
+		if len(procs) == 0 || time.Now().After(deadline) {
+			return procs
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// DryRun is both a FileSystem and an Executor that does nothing but record
+// what it was asked to do. Everything is still read from the real disk, so
+// later operations see the state from before the dry run
+type DryRun struct {
+	osFileSystem
+	Ops []DryRunOp
+}
+
+type DryRunOp struct {
+	Op   string   `json:"op"`
+	Args []string `json:"args"`
+}
+
+func (op DryRunOp) String() string {
+	return op.Op + " " + strings.Join(op.Args, " ")
+}
+
+// StartDryRun makes FS and Exec record everything instead of doing it
+func StartDryRun() *DryRun {
+	d := &DryRun{}
+	FS = d
+	Exec = d
+	return d
+}
+
+func (d *DryRun) record(op string, args ...string) {
+	d.Ops = append(d.Ops, DryRunOp{op, args})
+	Log.Debug("Dry run:", op, strings.Join(args, " "))
+}
+
+func (d *DryRun) Rename(from, to string) error {
+	d.record("rename", from, to)
+	return nil
+}
+
+func (d *DryRun) Remove(name string) error {
+	d.record("remove", name)
+	return nil
+}
+
+func (d *DryRun) RemoveAll(name string) error {
+	d.record("remove-all", name)
+	return nil
+}
+
+func (d *DryRun) MkdirAll(name string, perm os.FileMode) error {
+	if !ExistsFile(name) {
+		d.record("mkdir", name, perm.String())
+	}
+	return nil
+}
+
+func (d *DryRun) Chmod(name string, mode os.FileMode) error {
+	d.record("chmod", name, mode.String())
+	return nil
+}
+
+func (d *DryRun) Chown(name string, uid, gid int) error {
+	d.record("chown", name, strconv.Itoa(uid)+":"+strconv.Itoa(gid))
+	return nil
+}
+
+func (d *DryRun) WriteFile(name string, data []byte, perm os.FileMode) error {
+	d.record("write", name, strconv.Itoa(len(data))+" bytes")
+	return nil
+}
+
+func (d *DryRun) Create(name string) (WritableFile, error) {
+	return &dryRunFile{d, name, 0}, nil
+}
+
+func (d *DryRun) CreateTemp(dir, pattern string) (WritableFile, error) {
+	name := path.Join(dir, strings.Replace(pattern, "*", "dry-run", 1))
+	if !strings.Contains(pattern, "*") {
+		name += "dry-run"
+	}
+	return &dryRunFile{d, name, 0}, nil
+}
+
+func (d *DryRun) MkdirTemp(dir, pattern string) (string, error) {
+	name := path.Join(dir, strings.Replace(pattern, "*", "dry-run", 1))
+	if !strings.Contains(pattern, "*") {
+		name += "dry-run"
+	}
+	d.record("mkdir", name, os.FileMode(0700).String())
+	return name, nil
+}
+
+func (d *DryRun) Run(name string, args ...string) error {
+	d.record("exec", Prepend(args, name)...)
+	return nil
+}
+
+func (d *DryRun) Download(url, dest string, _ func(file, sha256Hex string) error) error {
+	d.record("download", url, dest)
+	return nil
+}
+
+func (d *DryRun) Start(cmd *exec.Cmd) error {
+	d.record("start", cmd.Args...)
+	return nil
+}
+
+func (d *DryRun) Terminate(pids []int, _ time.Duration) error {
+	d.record("terminate", SliceMap(pids, strconv.Itoa)...)
+	return nil
+}
+
+// dryRunFile records the write once closed, with how much would have been written
+type dryRunFile struct {
+	d    *DryRun
+	name string
+	n    int64
+}
+
+func (f *dryRunFile) Write(p []byte) (int, error) {
+	f.n += int64(len(p))
+	return len(p), nil
+}
+
+func (f *dryRunFile) Close() error {
+	if f.d != nil {
+		f.d.record("write", f.name, strconv.FormatInt(f.n, 10)+" bytes")
+		f.d = nil
+	}
+	return nil
+}
+
+func (f *dryRunFile) Name() string {
+	return f.name
+}
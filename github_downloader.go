@@ -9,22 +9,21 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"io"
 	"net/http"
 	"os"
 	path "path/filepath"
 	"regexp"
-	"strconv"
-	"strings"
 )
 
 type GithubRelease struct {
-	Name    string `json:"name"`
-	TagName string `json:"tag_name"`
-	Assets  []struct {
-		Name        string `json:"name"`
-		DownloadURL string `json:"browser_download_url"`
-	} `json:"assets"`
+	Name    string        `json:"name"`
+	TagName string        `json:"tag_name"`
+	Assets  []GithubAsset `json:"assets"`
+}
+
+type GithubAsset struct {
+	Name        string `json:"name"`
+	DownloadURL string `json:"browser_download_url"`
 }
 
 var ReleaseData GithubRelease
@@ -36,32 +35,58 @@ var LatestHash = "Unknown"
 var IsDevInstall bool
 
 func GetGithubRelease(url string) (*GithubRelease, error) {
+	var data GithubRelease
+	if err := getGithubJSON(url, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func getGithubJSON(url string, data any) error {
 	Log.Debug("Fetching", url)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		Log.Error("Failed to create Request", err)
-		return nil, err
+		return err
 	}
 
 	req.Header.Set("User-Agent", UserAgent)
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient(url).Do(req)
 	if err != nil {
 		Log.Error("Failed to send Request", err)
-		return nil, err
+		return err
 	}
 
 	defer res.Body.Close()
 
-	var data GithubRelease
+	if res.StatusCode >= 300 {
+		err = errors.New(url + ": " + res.Status)
+		Log.Error("Failed to fetch release", err)
+		return err
+	}
 
-	if err = json.NewDecoder(res.Body).Decode(&data); err != nil {
+	if err = json.NewDecoder(res.Body).Decode(data); err != nil {
 		Log.Error("Failed to decode GitHub JSON Response", err)
+		return err
+	}
+
+	return nil
+}
+
+// FetchLatestRelease fetches the release to install: the one given with
+// --version, or the latest one of the active channel
+func FetchLatestRelease() (*GithubRelease, error) {
+	source, err := GetReleaseSource()
+	if err != nil {
 		return nil, err
 	}
 
-	return &data, nil
+	if versionArg != "" {
+		return FetchReleaseVersion(source, versionArg)
+	}
+	return source.FetchRelease()
 }
 
 func InitGithubDownloader() {
@@ -80,109 +105,125 @@ func InitGithubDownloader() {
 			GithubDoneChan <- GithubError == nil
 		}()
 
-		data, err := GetGithubRelease(ReleaseUrl)
+		if OfflineInstallRequested() {
+			Log.Debug("Offline install, not fetching releases")
+			return
+		}
+
+		data, err := FetchLatestRelease()
 		if err != nil {
 			GithubError = err
 			return
 		}
 
-		ReleaseData = *data
-
-		i := strings.LastIndex(data.Name, " ") + 1
-		LatestHash = data.Name[i:]
+		SelectRelease(data)
 		Log.Debug("Finished fetching GitHub Data")
 		Log.Debug("Latest hash is", LatestHash, "Local Install is", Ternary(LatestHash == InstalledHash, "up to date!", "outdated!"))
 	}()
 
-	// either .asar file or directory with main.js file (in DEV)
-	EquicordFile := EquicordDirectory
-
-	stat, err := os.Stat(EquicordFile)
-	if err != nil {
+	if !ExistsFile(EquicordDirectory) {
 		return
 	}
 
-	// dev
-	if stat.IsDir() {
-		EquicordFile = path.Join(EquicordFile, "main.js")
-	}
-
-	// Check hash of installed version if exists
-	b, err := os.ReadFile(EquicordFile)
-	if err != nil {
-		return
+	Log.Debug("Found existing Equicord Install. Checking for hash...")
+	if hash, err := ReadEquicordHash(EquicordDirectory); err != nil {
+		Log.Debug(err)
+	} else {
+		InstalledHash = hash
+		Log.Debug("Existing hash is", InstalledHash)
 	}
+}
 
-	Log.Debug("Found existing Equicord Install. Checking for hash...")
+var equicordHashRegex = regexp.MustCompile(`// Equicord (\w+)`)
 
-	re := regexp.MustCompile(`// Equicord (\w+)`)
-	match := re.FindSubmatch(b)
-	if match != nil {
-		InstalledHash = string(match[1])
-		Log.Debug("Existing hash is", InstalledHash)
+// ReadEquicordHash returns the git hash from the "// Equicord <hash>" header
+// of an Equicord asar, or of the main.js of a dev build directory
+func ReadEquicordHash(equicordFile string) (string, error) {
+	if stat, err := FS.Stat(equicordFile); err == nil && stat.IsDir() {
+		equicordFile = path.Join(equicordFile, "main.js")
+	}
 
-	} else {
-		Log.Debug("Didn't find hash")
+	b, err := FS.ReadFile(equicordFile)
+	if err != nil {
+		return "", err
+	}
 
+	match := equicordHashRegex.FindSubmatch(b)
+	if match == nil {
+		return "", errors.New("Didn't find hash in " + equicordFile)
 	}
+	return string(match[1]), nil
 }
 
-func installLatestBuilds() (retErr error) {
+func installLatestBuilds() error {
 	Log.Debug("Installing latest builds...")
 
 	if IsDevInstall {
 		Log.Debug("Skipping due to dev install")
-		return
+		return nil
 	}
-
-	downloadUrl := ""
-	for _, ass := range ReleaseData.Assets {
-		if ass.Name == "desktop.asar" {
-			downloadUrl = ass.DownloadURL
-			break
-		}
+	if err := installRelease(&ReleaseData, EquicordDirectory); err != nil {
+		return err
+	}
+	InstalledHash = installedHash(&ReleaseData, EquicordDirectory)
+	if ReleaseData.Hash() == "" {
+		LatestHash = InstalledHash
 	}
+	return nil
+}
 
+// installRelease replaces the Bashcord asar at dest with the verified
+// desktop.asar of release
+func installRelease(release *GithubRelease, dest string) (retErr error) {
+	downloadUrl := release.AssetURL("desktop.asar")
 	if downloadUrl == "" {
 		retErr = errors.New("Didn't find desktop.asar download link")
 		Log.Error(retErr)
 		return
 	}
 
+	var checksums map[string]string
+	if SkipReleaseVerification {
+		Log.Warn("BASHCORD_INSECURE_SKIP_VERIFY is set, NOT verifying desktop.asar!")
+	} else {
+		checksums, retErr = FetchReleaseChecksums(release)
+		if retErr != nil {
+			Log.Error(retErr)
+			return
+		}
+	}
+
 	Log.Debug("Downloading desktop.asar")
 
-	res, err := http.Get(downloadUrl)
-	if err == nil && res.StatusCode >= 300 {
-		err = errors.New(res.Status)
-	}
+	err := Exec.Download(downloadUrl, dest, func(file, sha256Hex string) error {
+		if !SkipReleaseVerification {
+			if err := VerifyChecksum(checksums, "desktop.asar", sha256Hex); err != nil {
+				return err
+			}
+			Log.Debug("desktop.asar checksum is valid")
+		}
+
+		return checkAsar(file)
+	})
 	if err != nil {
-		Log.Error("Failed to download desktop.asar:", err)
+		Log.Error("Failed to install desktop.asar:", err)
 		retErr = err
 		return
 	}
-	out, err := os.OpenFile(EquicordDirectory, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		Log.Error("Failed to create", EquicordDirectory+":", err)
-		retErr = err
-		return
+
+	_ = FixOwnership(dest)
+	if ExistsFile(dest + ".prev") {
+		_ = FixOwnership(dest + ".prev")
 	}
-	read, err := io.Copy(out, res.Body)
+	return
+}
+
+// checkAsar makes sure file is an asar, as Discord would fail to require()
+// or load anything else
+func checkAsar(file string) error {
+	_, closer, err := openAsar(file)
 	if err != nil {
-		Log.Error("Failed to download to", EquicordDirectory+":", err)
-		retErr = err
-		return
-	}
-	contentLength := res.Header.Get("Content-Length")
-	expected := strconv.FormatInt(read, 10)
-	if expected != contentLength {
-		err = errors.New("Unexpected end of input. Content-Length was " + contentLength + ", but I only read " + expected)
-		Log.Error(err.Error())
-		retErr = err
-		return
+		return err
 	}
-
-	_ = FixOwnership(EquicordDirectory)
-
-	InstalledHash = LatestHash
-	return
+	return closer.Close()
 }
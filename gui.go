@@ -28,6 +28,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -55,6 +56,43 @@ var (
 	acceptedOpenAsar   bool
 	showedUpdatePrompt bool
 
+	backups    []*Backup
+	backupsErr error
+
+	// Sent by autoUpdate once it is done, see applyAutoUpdate
+	autoUpdateChan = make(chan autoUpdateDone, 1)
+	// Held by autoUpdate and the buttons patching or downloading, one at a time
+	patchLock sync.Mutex
+
+	// Release channels, read once as GetChannel hits the disk
+	activeChannel string
+	channelNames  []string
+
+	// Releases for the version dropdown, fetched when the advanced panel opens.
+	// Written from the goroutine fetching them, so only touched with releasesMu held
+	releasesMu      sync.Mutex
+	releases        []*GithubRelease
+	releasesErr     error
+	fetchingRelease bool
+
+	// File picker of the offline install
+	offlineFile    string
+	offlineDir     string
+	offlineEntries []string
+
+	// Install whose interrupted patch/unpatch we are asking about
+	recoveringInstall *DiscordInstall
+	promptedRecovery  = map[*DiscordInstall]bool{}
+
+	// Read-only install we offer to patch a copy of, see ReadOnlyModal
+	readOnlyInstall *DiscordInstall
+
+	// Action waiting on KillConfirmModal, and the running installs it touches
+	killPending         func()
+	killPendingDiscords []*DiscordInstall
+	// What the user answered in KillConfirmModal, read by ConfirmKillDiscord
+	killConsent = map[*DiscordInstall]bool{}
+
 	// Nouvelles variables pour les fonctionnalités avancées
 	currentTheme      = "fishstick" // fishstick, dark, skullkid, sanglant, terminal, pepe, wumpus
 	showAdvancedMode  = false
@@ -62,6 +100,7 @@ var (
 	showNotifications = true
 	compactMode       = false
 	animationEnabled  = true
+	launchAfterPatch  = false
 
 	// Variables pour les statistiques
 	installCount    = 0
@@ -100,7 +139,6 @@ var (
 
 func init() {
 	LogLevel = LevelDebug
-	loadUserPreferences()
 }
 
 // Fonctions pour la gestion des thèmes
@@ -182,12 +220,48 @@ func getThemeColors(theme string) map[string]color.RGBA {
 }
 
 func loadUserPreferences() {
-	// TODO: Charger les préférences depuis un fichier de configuration
-	// Pour l'instant, on utilise les valeurs par défaut
+	config, err := ReadConfig()
+	if err != nil {
+		Log.Warn("Failed to load preferences, using defaults:", err)
+		return
+	}
+
+	prefs := config.GUI
+	currentTheme = prefs.Theme
+	audioVolume = min(max(prefs.Volume, 0), maxVolume)
+	autoUpdateEnabled = prefs.AutoUpdate
+	showNotifications = prefs.Notifications
+	compactMode = prefs.CompactMode
+	animationEnabled = prefs.Animations
+	launchAfterPatch = prefs.LaunchAfterPatch
+	installCount = prefs.InstallCount
+	lastInstallTime = prefs.LastInstallTime
+	// "auto" is the default and not saved, so the cli keeps asking
+	preferredBranch = Ternary(config.Branch != "", config.Branch, "auto")
 }
 
 func saveUserPreferences() {
-	// TODO: Sauvegarder les préférences dans un fichier de configuration
+	config, err := ReadConfig()
+	if err != nil {
+		Log.Warn("Not saving preferences as they failed to load:", err)
+		return
+	}
+
+	config.GUI = GUIPreferences{
+		Theme:            currentTheme,
+		Volume:           audioVolume,
+		AutoUpdate:       autoUpdateEnabled,
+		Notifications:    showNotifications,
+		CompactMode:      compactMode,
+		Animations:       animationEnabled,
+		LaunchAfterPatch: launchAfterPatch,
+		InstallCount:     installCount,
+		LastInstallTime:  lastInstallTime,
+	}
+	config.Branch = Ternary(preferredBranch != "auto", preferredBranch, "")
+	if err = config.Save(); err != nil {
+		Log.Warn("Failed to save preferences:", err)
+	}
 }
 
 // Fonction pour démarrer la musique en arrière-plan
@@ -287,13 +361,19 @@ func stopBackgroundMusic() {
 }
 
 func main() {
+	// Not in init, BaseDir isn't set yet then
+	loadUserPreferences()
 	InitGithubDownloader()
+	activeChannel, channelNames = GetChannel(), ChannelNames()
 	discords = FindDiscords()
 
 	customChoiceIdx = len(discords)
+	radioIdx = preferredDiscordIdx()
 
 	go func() {
-		<-GithubDoneChan
+		if <-GithubDoneChan && autoUpdateEnabled {
+			autoUpdate()
+		}
 		g.Update()
 	}()
 
@@ -328,6 +408,7 @@ func main() {
 	go func() {
 		<-c
 		stopBackgroundMusic()
+		saveUserPreferences()
 		os.Exit(0)
 	}()
 
@@ -335,6 +416,8 @@ func main() {
 
 	// Nettoyer quand la fenêtre se ferme
 	stopBackgroundMusic()
+	// Le volume n'est sauvegardé qu'ici, pas à chaque mouvement du slider
+	saveUserPreferences()
 }
 
 type CondWidget struct {
@@ -351,6 +434,108 @@ func (w *CondWidget) Build() {
 	}
 }
 
+// preferredDiscordIdx returns the index of the first install of the preferred
+// branch, or of the first install at all
+func preferredDiscordIdx() int {
+	if preferredBranch == "auto" {
+		return 0
+	}
+	return max(0, SliceIndexFunc(discords, func(d any) bool {
+		return d.(*DiscordInstall).branch == preferredBranch
+	}))
+}
+
+// autoUpdateDone is what autoUpdate did, for the render loop to take in
+type autoUpdateDone struct {
+	hash    string                              // the Bashcord installed, if any
+	patched map[*DiscordInstall]*DiscordInstall // the re-patched copy of each install
+	result  string
+	failed  bool
+}
+
+// autoUpdate installs the latest Bashcord and re-patches all patched installs
+// with it. Runs in the background on launch. It only reads the installs and
+// the hashes the render loop uses, which takes in its changes with applyAutoUpdate
+func autoUpdate() {
+	if IsDevInstall || InstalledHash == "None" || LatestHash == InstalledHash {
+		return
+	}
+
+	patchLock.Lock()
+	defer patchLock.Unlock()
+
+	release, from, to := ReleaseData, InstalledHash, LatestHash
+	done := autoUpdateDone{patched: make(map[*DiscordInstall]*DiscordInstall)}
+	defer func() { autoUpdateChan <- done }()
+
+	Log.Info("Auto updating Bashcord from", from, "to", to)
+	if err := installRelease(&release, EquicordDirectory); err != nil {
+		done.result = "La mise à jour automatique de Bashcord a échoué :\n" + err.Error()
+		done.failed = true
+		return
+	}
+	done.hash = installedHash(&release, EquicordDirectory)
+
+	var failed, running []string
+	for _, d := range discords {
+		di := d.(*DiscordInstall)
+		// Interrupted installs are up to the user, see RecoverJournalModal
+		if !di.isPatched || di.journal != nil {
+			continue
+		}
+		// Nobody is there to agree to closing it, see KillConfirmModal
+		if DiscordRunning(di) {
+			Log.Info("Not re-patching", di.path+", Discord is running")
+			running = append(running, di.path)
+			continue
+		}
+		copied := *di
+		if err := copied.patchWith(EquicordDirectory); err != nil {
+			failed = append(failed, di.path+" : "+err.Error())
+		} else {
+			// Should it have started since and been stopped
+			relaunch(&copied, false)
+		}
+		done.patched[di] = &copied
+	}
+
+	done.result = "Bashcord a été mis à jour automatiquement de " + from + " vers " + done.hash + ".\nRedémarrez Discord pour en profiter."
+	if len(running) > 0 {
+		done.result += "\n\nDiscord était ouvert, pas re-patché :\n" + strings.Join(running, "\n") +
+			"\nFermez-le puis cliquez sur Installer, ou cliquez directement et je le ferme pour vous."
+		done.failed = true
+	}
+	if len(failed) > 0 {
+		done.result += "\n\nÉchec du re-patch de :\n" + strings.Join(failed, "\n")
+		done.failed = true
+	}
+}
+
+// applyAutoUpdate takes in what autoUpdate did, if it is done
+func applyAutoUpdate() {
+	var done autoUpdateDone
+	select {
+	case done = <-autoUpdateChan:
+	default:
+		return
+	}
+
+	if done.hash != "" {
+		InstalledHash = done.hash
+		if ReleaseData.Hash() == "" {
+			LatestHash = done.hash
+		}
+	}
+	for i, d := range discords {
+		if copied, ok := done.patched[d.(*DiscordInstall)]; ok {
+			discords[i] = copied
+		}
+	}
+	if showNotifications || done.failed {
+		ShowModal("Mise à jour automatique", done.result)
+	}
+}
+
 func getChosenInstall() *DiscordInstall {
 	var choice *DiscordInstall
 	if radioIdx == customChoiceIdx {
@@ -364,29 +549,172 @@ func getChosenInstall() *DiscordInstall {
 	return choice
 }
 
-func InstallLatestBuilds() (err error) {
+// InstallLatestBuilds downloads the latest Bashcord. The caller holds patchLock
+func InstallLatestBuilds() error {
 	if IsDevInstall {
+		return nil
+	}
+	return installLatestBuilds()
+}
+
+func showBuildsError(err error) {
+	ShowModal("Oups !", "Échec de l'installation des dernières versions de Bashcord depuis GitHub :\n"+err.Error())
+}
+
+// ConfirmKillDiscord says whether PreparePatch may close the running Discord
+// of di, which only the "Fermer Discord" button of KillConfirmModal agrees to
+func ConfirmKillDiscord(di *DiscordInstall) bool {
+	return killConsent[di]
+}
+
+// confirmKill runs action, first asking through KillConfirmModal what to do
+// with those of dis whose Discord is running
+func confirmKill(action func(), dis ...*DiscordInstall) {
+	var running []*DiscordInstall
+	for _, di := range dis {
+		if !di.readOnly() && DiscordRunning(di) {
+			running = append(running, di)
+		}
+	}
+	if len(running) == 0 {
+		withPatchLock(action)
 		return
 	}
 
-	err = installLatestBuilds()
+	killPending, killPendingDiscords = action, running
+	g.OpenPopup("#kill-confirm")
+}
+
+// withPatchLock runs action unless autoUpdate is busy, which would block
+// rendering until it is done, and says whether it did
+func withPatchLock(action func()) bool {
+	if !patchLock.TryLock() {
+		showBusy()
+		return false
+	}
+	defer patchLock.Unlock()
+	action()
+	return true
+}
+
+func showBusy() {
+	ShowModal("Une seconde !", "La mise à jour automatique est en cours, réessayez quand elle aura fini.")
+}
+
+func handleKillConfirmed(kill bool) {
+	action, dis := killPending, killPendingDiscords
+	killPending, killPendingDiscords = nil, nil
+	g.CloseCurrentPopup()
+
+	if action == nil {
+		return
+	}
+	withPatchLock(func() {
+		for _, di := range dis {
+			killConsent[di] = kill
+			// Ask again, whatever was answered last time
+			di.leaveRunning = false
+		}
+		action()
+		for _, di := range dis {
+			delete(killConsent, di)
+		}
+	})
+}
+
+// relaunch starts again the Discord of di that PreparePatch closed, if any.
+// With launchAfterPatch, di is started anyway once patched
+func relaunch(di *DiscordInstall, patched bool) {
+	var err error
+	if di.relaunch != nil {
+		err = di.RelaunchDiscord()
+	} else if launchAfterPatch && patched {
+		err = di.LaunchDiscord()
+	}
 	if err != nil {
-		ShowModal("Oups !", "Échec de l'installation des dernières versions de Bashcord depuis GitHub :\n"+err.Error())
+		Log.Warn("Failed to launch Discord:", err)
 	}
-	return
 }
 
 func handlePatch() {
 	choice := getChosenInstall()
 	if choice != nil {
-		choice.Patch()
+		confirmKill(choice.Patch, choice)
+	}
+}
+
+// handleRepair downloads Bashcord again before patching the chosen install
+func handleRepair() {
+	var err error
+	if !withPatchLock(func() { err = InstallLatestBuilds() }) {
+		return
+	}
+	if err != nil {
+		showBuildsError(err)
+		return
+	}
+	handlePatch()
+}
+
+// handlePatchAll patches every detected install and reports how each went
+func handlePatchAll() {
+	if len(discords) == 0 {
+		ShowModal("Rien à patcher", "Aucune installation Discord trouvée.")
+		return
+	}
+	if CheckScuffedInstall() {
+		return
+	}
+	var dis []*DiscordInstall
+	for _, discord := range discords {
+		dis = append(dis, discord.(*DiscordInstall))
 	}
+	confirmKill(func() {
+		// Download once up front rather than fail each install the same way
+		if LatestHash != InstalledHash {
+			if err := InstallLatestBuilds(); err != nil {
+				showBuildsError(err)
+				return
+			}
+		}
+		patchAll(dis)
+	}, dis...)
+}
+
+func patchAll(dis []*DiscordInstall) {
+	var lines []string
+	failed, skipped := 0, 0
+	for _, di := range dis {
+		if di.readOnly() {
+			skipped++
+			lines = append(lines, "IGNORÉ "+di.branch+" ("+di.path+") : en lecture seule, sélectionnez-le pour en patcher une copie")
+			continue
+		}
+		if err := di.patch(); err != nil {
+			failed++
+			lines = append(lines, "ÉCHEC  "+di.branch+" ("+di.path+") : "+err.Error())
+		} else {
+			lines = append(lines, "OK     "+di.branch+" ("+di.path+")")
+			relaunch(di, true)
+		}
+	}
+
+	if failed != len(dis)-skipped {
+		installCount++
+		lastInstallTime = time.Now().Format("02/01/2006 15:04")
+		saveUserPreferences()
+	}
+	title := "Toutes les installations sont patchées"
+	if failed != 0 {
+		title = fmt.Sprintf("%d installation(s) sur %d en échec", failed, len(dis)-skipped)
+	}
+	ShowModal(title, strings.Join(lines, "\n")+"\n\nSi Discord est encore ouvert, fermez-le complètement puis redémarrez-le.")
 }
 
 func handleUnpatch() {
 	choice := getChosenInstall()
 	if choice != nil {
-		choice.Unpatch()
+		confirmKill(choice.Unpatch, choice)
 	}
 }
 
@@ -402,20 +730,26 @@ func handleOpenAsar() {
 func handleOpenAsarConfirmed() {
 	choice := getChosenInstall()
 	if choice != nil {
-		if choice.IsOpenAsar() {
-			if err := choice.UninstallOpenAsar(); err != nil {
-				handleErr(choice, err, "désinstaller OpenAsar de")
-			} else {
-				g.OpenPopup("#openasar-unpatched")
-				g.Update()
-			}
+		confirmKill(func() { toggleOpenAsar(choice) }, choice)
+	}
+}
+
+func toggleOpenAsar(choice *DiscordInstall) {
+	if choice.IsOpenAsar() {
+		if err := choice.UninstallOpenAsar(); err != nil {
+			handleErr(choice, err, "désinstaller OpenAsar de")
 		} else {
-			if err := choice.InstallOpenAsar(); err != nil {
-				handleErr(choice, err, "installer OpenAsar sur")
-			} else {
-				g.OpenPopup("#openasar-patched")
-				g.Update()
-			}
+			relaunch(choice, false)
+			g.OpenPopup("#openasar-unpatched")
+			g.Update()
+		}
+	} else {
+		if err := choice.InstallOpenAsar(); err != nil {
+			handleErr(choice, err, "installer OpenAsar sur")
+		} else {
+			relaunch(choice, false)
+			g.OpenPopup("#openasar-patched")
+			g.Update()
 		}
 	}
 }
@@ -448,9 +782,18 @@ func (di *DiscordInstall) Patch() {
 	if CheckScuffedInstall() {
 		return
 	}
+	if di.readOnly() {
+		readOnlyInstall = di
+		g.OpenPopup("#read-only")
+		return
+	}
 	if err := di.patch(); err != nil {
 		handleErr(di, err, "patcher")
 	} else {
+		relaunch(di, true)
+		installCount++
+		lastInstallTime = time.Now().Format("02/01/2006 15:04")
+		saveUserPreferences()
 		g.OpenPopup("#patched")
 	}
 }
@@ -459,6 +802,7 @@ func (di *DiscordInstall) Unpatch() {
 	if err := di.unpatch(); err != nil {
 		handleErr(di, err, "dépatcher")
 	} else {
+		relaunch(di, false)
 		g.OpenPopup("#unpatched")
 	}
 }
@@ -649,6 +993,393 @@ func UpdateModal() g.Widget {
 		)
 }
 
+func RecoverJournalModal() g.Widget {
+	description := ""
+	if di := recoveringInstall; di != nil && di.journal != nil {
+		action := Ternary(di.journal.Action == "patch", "Le patch", "Le dépatch")
+		description = action + " de " + di.path + " a été interrompu (crash, coupure de courant...).\n" +
+			"Discord risque de ne pas démarrer tant que ce n'est pas réglé.\n\n" +
+			"Voulez-vous terminer l'opération, ou l'annuler et revenir à l'état d'avant ?"
+	}
+
+	return g.Style().
+		SetStyle(g.StyleVarWindowPadding, 30, 30).
+		SetStyleFloat(g.StyleVarWindowRounding, 12).
+		To(
+			g.PopupModal("#recover-journal").
+				Flags(g.WindowFlagsNoTitleBar | g.WindowFlagsAlwaysAutoResize).
+				Layout(
+					g.Align(g.AlignCenter).To(
+						g.Style().SetFontSize(30).To(
+							g.Label("Opération interrompue !"),
+						),
+						g.Style().SetFontSize(20).To(
+							g.Label(description),
+						),
+						g.Dummy(0, 20),
+						g.Row(
+							g.Button("Terminer").
+								OnClick(func() {
+									handleRecoverJournal(true)
+								}).
+								Size(150, 30),
+							g.Button("Annuler l'opération").
+								OnClick(func() {
+									handleRecoverJournal(false)
+								}).
+								Size(150, 30),
+						),
+					),
+				),
+		)
+}
+
+func ReadOnlyModal() g.Widget {
+	title, description := "", ""
+	if di := readOnlyInstall; di != nil && di.isSnap {
+		title = "Discord snap"
+		description = di.path + " est un snap : snapd le monte en lecture seule et le remplace à chaque mise à jour,\n" +
+			"impossible donc d'y remplacer l'app.asar de Discord.\n\n" +
+			"Bashcord peut en copier une version modifiable dans ~/.local/share et patcher la copie.\n" +
+			"Le snap reste intact, mais lancez la copie à sa place. Repatchez-la quand le snap se met à jour."
+	} else if di != nil {
+		title = "Discord Nix"
+		description = di.path + " est dans le store Nix, en lecture seule : seul un rebuild du paquet peut le changer.\n\n" +
+			"Bashcord peut écrire un overlay nixpkgs qui patche le paquet au prochain rebuild,\n" +
+			"ou en copier une version modifiable dans ~/.local/share et patcher la copie.\n" +
+			"Dans ce cas lancez la copie à la place, et repatchez-la quand le paquet se met à jour."
+	}
+
+	return g.Style().
+		SetStyle(g.StyleVarWindowPadding, 30, 30).
+		SetStyleFloat(g.StyleVarWindowRounding, 12).
+		To(
+			g.PopupModal("#read-only").
+				Flags(g.WindowFlagsNoTitleBar | g.WindowFlagsAlwaysAutoResize).
+				Layout(
+					g.Align(g.AlignCenter).To(
+						g.Style().SetFontSize(30).To(
+							g.Label(title),
+						),
+						g.Style().SetFontSize(20).To(
+							g.Label(description),
+						),
+						g.Dummy(0, 20),
+						g.Row(
+							g.Button("Patcher une copie").
+								OnClick(handleCopyReadOnly).
+								Size(150, 30),
+							&CondWidget{readOnlyInstall != nil && readOnlyInstall.isNix, func() g.Widget {
+								return g.Button("Écrire un overlay").
+									OnClick(handleNixOverlay).
+									Size(150, 30)
+							}, nil},
+							g.Button("Annuler").
+								OnClick(func() {
+									readOnlyInstall = nil
+									g.CloseCurrentPopup()
+								}).
+								Size(150, 30),
+						),
+					),
+				),
+		)
+}
+
+func KillConfirmModal() g.Widget {
+	var lines []string
+	for _, di := range killPendingDiscords {
+		lines = append(lines, di.branch+" ("+di.path+")")
+	}
+	description := "Discord tourne encore :\n" + strings.Join(lines, "\n") + "\n\n"
+	if runtime.GOOS == "linux" {
+		description += "Le modifier sous ses pieds, c'est risquer qu'il défasse tout en quittant ou en se mettant à jour.\n" +
+			"Je le ferme et je le relance après, ou vous préférez le redémarrer vous-même ?"
+	} else {
+		description += "Il faut le fermer pour le modifier. Je le ferme et je le relance après ?"
+	}
+
+	return g.Style().
+		SetStyle(g.StyleVarWindowPadding, 30, 30).
+		SetStyleFloat(g.StyleVarWindowRounding, 12).
+		To(
+			g.PopupModal("#kill-confirm").
+				Flags(g.WindowFlagsNoTitleBar | g.WindowFlagsAlwaysAutoResize).
+				Layout(
+					g.Align(g.AlignCenter).To(
+						g.Style().SetFontSize(30).To(
+							g.Label("Discord est ouvert"),
+						),
+						g.Style().SetFontSize(20).To(
+							g.Label(description),
+						),
+						g.Dummy(0, 20),
+						g.Row(
+							g.Button("Fermer Discord").
+								OnClick(func() {
+									handleKillConfirmed(true)
+								}).
+								Size(150, 30),
+							// Only Linux can patch under a running Discord
+							&CondWidget{runtime.GOOS == "linux", func() g.Widget {
+								return g.Button("Le laisser tourner").
+									OnClick(func() {
+										handleKillConfirmed(false)
+									}).
+									Size(150, 30)
+							}, nil},
+							g.Button("Annuler").
+								OnClick(func() {
+									killPending, killPendingDiscords = nil, nil
+									g.CloseCurrentPopup()
+								}).
+								Size(150, 30),
+						),
+					),
+				),
+		)
+}
+
+// handleCopyReadOnly patches a copy of readOnlyInstall and selects it in the list
+func handleCopyReadOnly() {
+	di := readOnlyInstall
+	readOnlyInstall = nil
+	g.CloseCurrentPopup()
+
+	if di == nil {
+		return
+	}
+	withPatchLock(func() {
+		copied, err := CopyReadOnly(di)
+		if err != nil {
+			handleErr(di, err, "copier")
+			return
+		}
+
+		idx := SliceIndexFunc(discords, func(d any) bool { return d.(*DiscordInstall).path == copied.path })
+		if idx == -1 {
+			discords = append(discords, copied)
+			idx = len(discords) - 1
+			customChoiceIdx = len(discords)
+		} else {
+			discords[idx] = copied
+		}
+		radioIdx = idx
+		copied.Patch()
+		g.Update()
+	})
+}
+
+func handleNixOverlay() {
+	di := readOnlyInstall
+	readOnlyInstall = nil
+	g.CloseCurrentPopup()
+
+	if di == nil {
+		return
+	}
+	overlay, err := WriteNixOverlay(di)
+	if err != nil {
+		handleErr(di, err, "écrire un overlay pour")
+		return
+	}
+	ShowModal("Overlay écrit", "L'overlay est dans "+overlay+", les instructions sont dedans.\n"+
+		"Ajoutez-le à vos overlays nixpkgs puis rebuildez, Discord sera patché.")
+}
+
+func handleRecoverJournal(forward bool) {
+	di := recoveringInstall
+	recoveringInstall = nil
+	g.CloseCurrentPopup()
+
+	if di == nil {
+		return
+	}
+	confirmKill(func() {
+		if err := di.RecoverJournal(forward); err != nil {
+			handleErr(di, err, "récupérer")
+		}
+		g.Update()
+	}, di)
+}
+
+func handleShowBackups() {
+	backups, backupsErr = ListBackups()
+	g.OpenPopup("#backups")
+}
+
+func handleRestoreBackup(b *Backup) {
+	g.CloseCurrentPopup()
+
+	di := ParseDiscord(b.InstallPath, b.Branch)
+	if di == nil {
+		ShowModal("Échec de la restauration", b.InstallPath+" n'est plus une installation Discord valide.")
+		return
+	}
+	confirmKill(func() { restoreBackup(di, b) }, di)
+}
+
+func restoreBackup(di *DiscordInstall, b *Backup) {
+	if err := di.RestoreBackup(b); err != nil {
+		handleErr(di, err, "restaurer la sauvegarde de")
+		return
+	}
+	relaunch(di, false)
+
+	// Our copy of this install may be stale now
+	for _, d := range discords {
+		if d := d.(*DiscordInstall); d.path == di.path {
+			d.isOpenAsar = nil
+		}
+	}
+	ShowModal("Sauvegarde restaurée", "L'app.asar d'origine de "+di.path+" a été restauré.\nSi Discord est encore ouvert, fermez-le complètement puis redémarrez-le.")
+}
+
+func BackupsModal(colors map[string]color.RGBA) g.Widget {
+	var rows g.Widget
+	switch {
+	case backupsErr != nil:
+		rows = g.Label("Impossible de lire les sauvegardes : " + backupsErr.Error())
+	case len(backups) == 0:
+		rows = g.Label("Aucune sauvegarde pour l'instant. Elles sont créées à chaque patch ou installation d'OpenAsar.")
+	default:
+		rows = g.Child().Size(700, 300).Layout(
+			g.RangeBuilder("Backups", SliceMap(backups, func(b *Backup) any { return b }), func(i int, v any) g.Widget {
+				b := v.(*Backup)
+				//goland:noinspection GoDeprecation
+				text := fmt.Sprintf("%s  %s  %s %s  (%s)\n%s",
+					b.CreatedAt.Format(time.DateTime), b.ID, strings.Title(b.Branch),
+					Ternary(b.DiscordVersion != "", b.DiscordVersion, "?"), b.Reason, b.InstallPath)
+				return g.Row(
+					g.Button("Restaurer##"+b.ID).OnClick(func() {
+						handleRestoreBackup(b)
+					}),
+					g.Label(text),
+				)
+			}),
+		)
+	}
+
+	return g.Style().
+		SetStyle(g.StyleVarWindowPadding, 30, 30).
+		SetStyleFloat(g.StyleVarWindowRounding, 12).
+		To(
+			g.PopupModal("#backups").
+				Flags(g.WindowFlagsNoTitleBar | g.WindowFlagsAlwaysAutoResize).
+				Layout(
+					g.Style().SetFontSize(30).To(
+						g.Label("Sauvegardes des app.asar d'origine"),
+					),
+					g.Style().SetFontSize(16).SetColor(g.StyleColorText, colors["text"]).To(
+						rows,
+					),
+					g.Dummy(0, 20),
+					g.Button("Fermer").
+						OnClick(func() {
+							g.CloseCurrentPopup()
+						}).
+						Size(100, 30),
+				),
+		)
+}
+
+func handleShowOfflineInstall() {
+	if offlineFile == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			offlineFile = home + string(os.PathSeparator)
+		}
+	}
+	refreshOfflineEntries()
+	g.OpenPopup("#offline-install")
+}
+
+// refreshOfflineEntries lists the folders, asars and zips next to offlineFile
+func refreshOfflineEntries() {
+	dir := offlineFile
+	if !strings.HasSuffix(dir, string(os.PathSeparator)) {
+		dir = path.Dir(dir)
+	}
+	if dir == offlineDir && offlineEntries != nil {
+		return
+	}
+	offlineDir = dir
+	offlineEntries = []string{".." + string(os.PathSeparator)}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		ext := strings.ToLower(path.Ext(f.Name()))
+		switch {
+		case strings.HasPrefix(f.Name(), "."):
+		case f.IsDir():
+			offlineEntries = append(offlineEntries, f.Name()+string(os.PathSeparator))
+		case ext == ".asar" || ext == ".zip":
+			offlineEntries = append(offlineEntries, f.Name())
+		}
+	}
+}
+
+func handleOfflineInstall() {
+	g.CloseCurrentPopup()
+
+	if !patchLock.TryLock() {
+		showBusy()
+		return
+	}
+	err := InstallOffline(offlineFile)
+	patchLock.Unlock()
+	if err != nil {
+		ShowModal("Échec de l'installation hors ligne", err.Error())
+		return
+	}
+	handlePatch()
+}
+
+func OfflineInstallModal(colors map[string]color.RGBA) g.Widget {
+	return g.Style().
+		SetStyle(g.StyleVarWindowPadding, 30, 30).
+		SetStyleFloat(g.StyleVarWindowRounding, 12).
+		To(
+			g.PopupModal("#offline-install").
+				Flags(g.WindowFlagsNoTitleBar | g.WindowFlagsAlwaysAutoResize).
+				Layout(
+					g.Style().SetFontSize(30).To(
+						g.Label("Installer depuis un fichier"),
+					),
+					g.Style().SetFontSize(16).SetColor(g.StyleColorText, colors["text"]).To(
+						g.Label("Choisissez un desktop.asar, avec le SHA256SUMS signé de sa release à côté,\nou un zip contenant desktop.asar et SHA256SUMS.\nAucune connexion internet n'est nécessaire."),
+						g.Dummy(0, 10),
+						g.InputText(&offlineFile).Size(600).OnChange(refreshOfflineEntries),
+						g.Child().Size(600, 250).Layout(
+							g.RangeBuilder("OfflineEntries", SliceMap(offlineEntries, func(e string) any { return e }), func(i int, v any) g.Widget {
+								name := v.(string)
+								return g.Selectable(name).OnClick(func() {
+									offlineFile = path.Clean(path.Join(offlineDir, name))
+									if strings.HasSuffix(name, string(os.PathSeparator)) {
+										offlineFile += string(os.PathSeparator)
+									}
+									refreshOfflineEntries()
+								})
+							}),
+						),
+					),
+					g.Dummy(0, 20),
+					g.Row(
+						g.Button("Installer").
+							OnClick(handleOfflineInstall).
+							Size(100, 30),
+						g.Button("Annuler").
+							OnClick(func() {
+								g.CloseCurrentPopup()
+							}).
+							Size(100, 30),
+					),
+				),
+		)
+}
+
 func ShowModal(title, desc string) {
 	modalTitle = title
 	modalMessage = desc
@@ -740,6 +1471,7 @@ func renderThemeSwitcher(colors map[string]color.RGBA) g.Widget {
 				g.Combo("##theme", themes[currentIdx], themes, &currentIdx).
 					OnChange(func() {
 						currentTheme = themes[currentIdx]
+						saveUserPreferences()
 						g.Update()
 					}).
 					Size(150),
@@ -747,6 +1479,148 @@ func renderThemeSwitcher(colors map[string]color.RGBA) g.Widget {
 		)
 }
 
+// fetchReleases lists the releases for the version dropdown in the
+// background. Call with releasesMu held
+func fetchReleases() {
+	fetchingRelease = true
+	go func() {
+		r, err := ListReleases()
+		releasesMu.Lock()
+		releases, releasesErr = r, err
+		fetchingRelease = false
+		releasesMu.Unlock()
+		g.Update()
+	}()
+}
+
+// Fonction pour créer le sélecteur de version de Bashcord
+func renderVersionPicker(colors map[string]color.RGBA) g.Widget {
+	releasesMu.Lock()
+	if releases == nil && releasesErr == nil && !fetchingRelease && !IsDevInstall {
+		fetchReleases()
+	}
+	releases, releasesErr := releases, releasesErr
+	releasesMu.Unlock()
+
+	var picker g.Widget
+	switch {
+	case IsDevInstall:
+		picker = g.Label("installation de dev")
+	case releasesErr != nil:
+		picker = g.Label("impossible de lister les versions").Wrapped(true)
+	case releases == nil:
+		picker = g.Label("chargement...")
+	case len(releases) == 0:
+		picker = g.Label("aucune version publiée (même pas une)")
+	default:
+		names := SliceMap(releases, func(r *GithubRelease) string {
+			return r.TagName + Ternary(r.Hash() != "", " ("+r.Hash()+")", "") + Ternary(r.IsInstalled(), " - installée", "")
+		})
+		currentIdx := int32(max(0, SliceIndexFunc(releases, func(r *GithubRelease) bool {
+			return r.TagName == ReleaseData.TagName
+		})))
+		picker = g.Combo("##version", names[currentIdx], names, &currentIdx).
+			OnChange(func() {
+				SelectRelease(releases[currentIdx])
+				g.Update()
+			}).
+			Size(250)
+	}
+
+	return g.Style().
+		SetColor(g.StyleColorFrameBg, colors["secondary"]).
+		SetColor(g.StyleColorFrameBgHovered, colors["accent"]).
+		SetColor(g.StyleColorText, colors["text"]).
+		SetStyleFloat(g.StyleVarFrameRounding, 8).
+		SetStyle(g.StyleVarFramePadding, 8, 8).
+		To(
+			g.Row(
+				g.Label("Version de Bashcord:"),
+				g.Dummy(5, 0),
+				picker,
+				Tooltip("La version installée par Installer / Réparer"),
+			),
+		)
+}
+
+// Fonction pour créer le sélecteur de branche préférée
+func renderBranchPicker(colors map[string]color.RGBA) g.Widget {
+	branches := []string{"auto", "stable", "ptb", "canary"}
+	currentIdx := int32(max(0, SliceIndex(branches, preferredBranch)))
+
+	return g.Style().
+		SetColor(g.StyleColorFrameBg, colors["secondary"]).
+		SetColor(g.StyleColorFrameBgHovered, colors["accent"]).
+		SetColor(g.StyleColorText, colors["text"]).
+		SetStyleFloat(g.StyleVarFrameRounding, 8).
+		SetStyle(g.StyleVarFramePadding, 8, 8).
+		To(
+			g.Row(
+				g.Label("Branche préférée:"),
+				g.Dummy(5, 0),
+				g.Combo("##branch", branches[currentIdx], branches, &currentIdx).
+					OnChange(func() {
+						preferredBranch = branches[currentIdx]
+						radioIdx = preferredDiscordIdx()
+						saveUserPreferences()
+					}).
+					Size(100),
+			),
+		)
+}
+
+// handleChannelChanged switches to channel and fetches its latest release
+func handleChannelChanged(channel string) {
+	if err := SaveChannel(channel); err != nil {
+		ShowModal("Échec du changement de canal", err.Error())
+		return
+	}
+
+	activeChannel = channel
+	releasesMu.Lock()
+	releases, releasesErr = nil, nil
+	fetchingRelease = true
+	releasesMu.Unlock()
+	go func() {
+		defer g.Update()
+		defer func() {
+			releasesMu.Lock()
+			fetchingRelease = false
+			releasesMu.Unlock()
+		}()
+
+		data, err := FetchLatestRelease()
+		GithubError = err
+		if err == nil {
+			SelectRelease(data)
+		}
+	}()
+}
+
+// Fonction pour créer le sélecteur de canal
+func renderChannelPicker(colors map[string]color.RGBA) g.Widget {
+	channels := channelNames
+	currentIdx := int32(max(0, SliceIndex(channels, activeChannel)))
+
+	return g.Style().
+		SetColor(g.StyleColorFrameBg, colors["secondary"]).
+		SetColor(g.StyleColorFrameBgHovered, colors["accent"]).
+		SetColor(g.StyleColorText, colors["text"]).
+		SetStyleFloat(g.StyleVarFrameRounding, 8).
+		SetStyle(g.StyleVarFramePadding, 8, 8).
+		To(
+			g.Row(
+				g.Label("Canal:"),
+				g.Dummy(5, 0),
+				g.Combo("##channel", channels[currentIdx], channels, &currentIdx).
+					OnChange(func() {
+						handleChannelChanged(channels[currentIdx])
+					}).
+					Size(120),
+			),
+		)
+}
+
 // Fonction pour créer le contrôle de volume
 func renderVolumeControl(colors map[string]color.RGBA) g.Widget {
 	volume32 := float32(audioVolume)
@@ -847,7 +1721,7 @@ func renderAdvancedPanel(colors map[string]color.RGBA) g.Widget {
 		SetStyle(g.StyleVarWindowPadding, 15, 15).
 		To(
 			g.Child().
-				Size(g.Auto, 100).
+				Size(g.Auto, 150).
 				Layout(
 					g.Style().
 						SetColor(g.StyleColorText, colors["text"]).
@@ -857,18 +1731,33 @@ func renderAdvancedPanel(colors map[string]color.RGBA) g.Widget {
 						),
 					g.Dummy(0, 8),
 					g.Row(
-						g.Checkbox("Mise à jour automatique", &autoUpdateEnabled),
+						g.Checkbox("Mise à jour automatique", &autoUpdateEnabled).OnChange(saveUserPreferences),
 						g.Dummy(20, 0),
-						g.Checkbox("Notifications", &showNotifications),
+						g.Checkbox("Notifications", &showNotifications).OnChange(saveUserPreferences),
 						g.Dummy(20, 0),
-						g.Checkbox("Mode compact", &compactMode),
+						g.Checkbox("Mode compact", &compactMode).OnChange(saveUserPreferences),
 						g.Dummy(20, 0),
-						g.Checkbox("Animations", &animationEnabled),
+						g.Checkbox("Animations", &animationEnabled).OnChange(saveUserPreferences),
+						g.Dummy(20, 0),
+						g.Checkbox("Lancer Discord après le patch", &launchAfterPatch).OnChange(saveUserPreferences),
+					),
+					g.Dummy(0, 8),
+					g.Row(
+						renderBranchPicker(colors),
+						g.Dummy(20, 0),
+						renderChannelPicker(colors),
+						g.Dummy(20, 0),
+						renderVersionPicker(colors),
 					),
 				),
 		)
 }
 
+// gap est un espace vertical, réduit en mode compact
+func gap(height float32) g.Widget {
+	return g.Dummy(0, Ternary(compactMode, height/3, height))
+}
+
 func renderInstaller() g.Widget {
 	candidates := makeAutoComplete()
 	wi, _ := win.GetSize()
@@ -880,20 +1769,34 @@ func renderInstaller() g.Widget {
 		currentDiscord = discords[radioIdx].(*DiscordInstall)
 	}
 	var isOpenAsar = currentDiscord != nil && currentDiscord.IsOpenAsar()
+	buttonHeight := Ternary[float32](compactMode, 32, 50)
 
 	if CanUpdateSelf() && !showedUpdatePrompt {
 		showedUpdatePrompt = true
 		g.OpenPopup("#update-prompt")
 	}
 
+	applyAutoUpdate()
+
+	if recoveringInstall == nil {
+		for _, d := range discords {
+			if di := d.(*DiscordInstall); di.journal != nil && !promptedRecovery[di] {
+				promptedRecovery[di] = true
+				recoveringInstall = di
+				g.OpenPopup("#recover-journal")
+				break
+			}
+		}
+	}
+
 	layout := g.Layout{
 		// Header avec statistiques
 		renderHeader(colors),
-		g.Dummy(0, 15),
+		gap(15),
 
 		// Panneau de contrôle avancé
 		renderAdvancedPanel(colors),
-		g.Dummy(0, 10),
+		gap(10),
 
 		// Séparateur stylisé
 		g.Style().
@@ -901,23 +1804,27 @@ func renderInstaller() g.Widget {
 			To(
 				g.Separator(),
 			),
-		g.Dummy(0, 10),
-
-		// Carte d'information de sécurité
-		createInfoCard(
-			"Sécurité",
-			"**Github** est le seul endroit officiel pour obtenir Bashcord. Tout autre site prétendant être nous est malveillant.\n"+
-				"Si vous avez téléchargé depuis une autre source, vous devriez tout supprimer/désinstaller immédiatement, effectuer une analyse anti-malware et changer votre mot de passe Discord.",
-			colors,
-			100,
-		),
-
-		g.Dummy(0, 15),
+		gap(10),
+
+		// Carte d'information de sécurité, raccourcie en mode compact
+		&CondWidget{compactMode, func() g.Widget {
+			return createInfoCard("Sécurité", "**Github** est le seul endroit officiel pour obtenir Bashcord. Tout autre site prétendant être nous est malveillant.", colors, 50)
+		}, func() g.Widget {
+			return createInfoCard(
+				"Sécurité",
+				"**Github** est le seul endroit officiel pour obtenir Bashcord. Tout autre site prétendant être nous est malveillant.\n"+
+					"Si vous avez téléchargé depuis une autre source, vous devriez tout supprimer/désinstaller immédiatement, effectuer une analyse anti-malware et changer votre mot de passe Discord.",
+				colors,
+				100,
+			)
+		}},
+
+		gap(15),
 
 		// Titre de sélection
 		g.Style().
 			SetColor(g.StyleColorText, colors["accent"]).
-			SetFontSize(24).
+			SetFontSize(Ternary[float32](compactMode, 18, 24)).
 			To(
 				g.Label("Sélectionnez une installation Discord à patcher"),
 			),
@@ -925,9 +1832,6 @@ func renderInstaller() g.Widget {
 		// Message d'erreur si aucune installation trouvée
 		&CondWidget{len(discords) == 0, func() g.Widget {
 			s := "Aucune installation Discord trouvee. Vous devez d'abord installer Discord."
-			if runtime.GOOS == "linux" {
-				s += " snap n'est pas pris en charge."
-			}
 			return createInfoCard("Aucune Installation", s, colors, 80)
 		}, nil},
 
@@ -943,6 +1847,9 @@ func renderInstaller() g.Widget {
 					if d.isPatched {
 						text += " [PATCHE]"
 					}
+					if d.readOnly() {
+						text += Ternary(d.isSnap, " [SNAP", " [NIX") + ", LECTURE SEULE]"
+					}
 					return g.Style().
 						SetColor(g.StyleColorCheckMark, colors["accent"]).
 						SetStyleFloat(g.StyleVarFrameRounding, 6).
@@ -961,11 +1868,11 @@ func renderInstaller() g.Widget {
 					),
 			),
 
-		g.Dummy(0, 10),
+		gap(10),
 
 		// Champ de saisie personnalisé stylisé
 		g.Style().
-			SetStyle(g.StyleVarFramePadding, 16, 16).
+			SetStyle(g.StyleVarFramePadding, 16, Ternary[float32](compactMode, 6, 16)).
 			SetColor(g.StyleColorFrameBg, colors["secondary"]).
 			SetColor(g.StyleColorFrameBgHovered, colors["accent"]).
 			SetColor(g.StyleColorFrameBgActive, colors["accent"]).
@@ -1002,24 +1909,24 @@ func renderInstaller() g.Widget {
 					),
 			),
 
-		g.Dummy(0, 20),
+		gap(20),
 
 		// Boutons d'action stylisés
 		g.Style().SetFontSize(16).To(
 			g.Row(
-				createStyledButton("Installer", handlePatch, colors, (w-60)/4, 50),
-				createStyledButton("Réparer", func() {
-					if IsDevInstall {
-						handlePatch()
-					} else {
-						err := InstallLatestBuilds()
-						if err == nil {
-							handlePatch()
-						}
-					}
-				}, colors, (w-60)/4, 50),
-				createStyledButton("Désinstaller", handleUnpatch, colors, (w-60)/4, 50),
-				createStyledButton(Ternary(isOpenAsar, "Désinstaller OpenAsar", "Installer OpenAsar"), handleOpenAsar, colors, (w-60)/4, 50),
+				createStyledButton("Installer", handlePatch, colors, (w-60)/4, buttonHeight),
+				createStyledButton("Réparer", handleRepair, colors, (w-60)/4, buttonHeight),
+				createStyledButton("Désinstaller", handleUnpatch, colors, (w-60)/4, buttonHeight),
+				createStyledButton(Ternary(isOpenAsar, "Désinstaller OpenAsar", "Installer OpenAsar"), handleOpenAsar, colors, (w-60)/4, buttonHeight),
+			),
+		),
+
+		gap(10),
+		g.Style().SetFontSize(14).To(
+			g.Row(
+				createStyledButton("Restaurer une sauvegarde", handleShowBackups, colors, 220, 30),
+				createStyledButton("Installer depuis un fichier", handleShowOfflineInstall, colors, 220, 30),
+				createStyledButton("Patcher toutes les installations", handlePatchAll, colors, 260, 30),
 			),
 		),
 
@@ -1039,10 +1946,15 @@ func renderInstaller() g.Widget {
 			"Pour installer OpenAsar, appuyez sur Accepter et cliquez à nouveau sur 'Installer OpenAsar'.", true),
 		InfoModal("#openasar-patched", "OpenAsar installé avec succès", "Si Discord est encore ouvert, fermez-le complètement d'abord. Ensuite redémarrez-le et vérifiez qu'OpenAsar s'est installé avec succès !"),
 		InfoModal("#openasar-unpatched", "OpenAsar désinstallé avec succès", "Si Discord est encore ouvert, fermez-le complètement d'abord. Ensuite redémarrez-le et il devrait être revenu à l'état d'origine !"),
-		InfoModal("#invalid-custom-location", "Emplacement invalide", "L'emplacement spécifié n'est pas une installation Discord valide.\nAssurez-vous de sélectionner le dossier de base.\n\nAstuce : Discord snap n'est pas pris en charge. utilisez flatpak ou .deb"),
+		InfoModal("#invalid-custom-location", "Emplacement invalide", "L'emplacement spécifié n'est pas une installation Discord valide.\nAssurez-vous de sélectionner le dossier de base.\n\nAstuce : pour un snap, c'est /snap/discord"),
 		InfoModal("#modal"+strconv.Itoa(modalId), modalTitle, modalMessage),
 
 		UpdateModal(),
+		RecoverJournalModal(),
+		ReadOnlyModal(),
+		KillConfirmModal(),
+		BackupsModal(colors),
+		OfflineInstallModal(colors),
 	}
 
 	return layout
@@ -1152,7 +2064,7 @@ func loop() {
 									return g.Style().
 										SetColor(g.StyleColorText, colors["success"]).
 										To(
-											g.Label("Dernière version de Bashcord : " + LatestHash),
+											g.Label("Dernière version de Bashcord : " + LatestHash + " (canal " + activeChannel + ")"),
 										)
 								}, func() g.Widget {
 									return createInfoCard("Erreur GitHub", "Echec de recuperation des informations depuis GitHub : "+GithubError.Error(), colors, 60)
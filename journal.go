@@ -0,0 +1,283 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	path "path/filepath"
+	"time"
+)
+
+// The journal lives in the directory containing app.asar, so resources/ for
+// normal installs and the install itself for system electron ones
+const JournalFileName = "bashcord-journal.json"
+
+const journalVersion = 1
+
+const (
+	StepRename = "rename"
+	// StepWriteStub writes the stub app.asar loading the journal's EquicordDirectory to To
+	StepWriteStub = "write-stub"
+)
+
+type JournalStep struct {
+	Op   string `json:"op"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+}
+
+// PatchJournal records every step of a patch or unpatch on disk before it
+// happens, so that an interrupted operation can be finished or reverted on
+// the next start instead of leaving a broken install behind.
+//
+// All steps are idempotent: a step that was done right before a crash, but
+// not yet marked as done, is detected and not redone or undone twice.
+type PatchJournal struct {
+	Version           int           `json:"version"`
+	Action            string        `json:"action"`
+	Dir               string        `json:"dir"`
+	IsSystemElectron  bool          `json:"isSystemElectron"`
+	EquicordDirectory string        `json:"equicordDirectory"`
+	Steps             []JournalStep `json:"steps"`
+	// Cleanup is removed once all steps are done. Nothing can be rolled back
+	// from that point on
+	Cleanup   []string  `json:"cleanup,omitempty"`
+	Done      int       `json:"done"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+func newJournal(action, dir string, isSystemElectron bool, steps []JournalStep) *PatchJournal {
+	return &PatchJournal{
+		Version:           journalVersion,
+		Action:            action,
+		Dir:               dir,
+		IsSystemElectron:  isSystemElectron,
+		EquicordDirectory: EquicordDirectory,
+		Steps:             steps,
+		StartedAt:         time.Now(),
+	}
+}
+
+func journalPath(dir string) string {
+	return path.Join(dir, JournalFileName)
+}
+
+// ReadJournal returns the unfinished journal in dir, or nil if there is none
+func ReadJournal(dir string) (*PatchJournal, error) {
+	b, err := FS.ReadFile(journalPath(dir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var j PatchJournal
+	if err = json.Unmarshal(b, &j); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", journalPath(dir), err)
+	}
+	if j.Version != journalVersion {
+		return nil, fmt.Errorf("Unsupported journal version %d in %s", j.Version, journalPath(dir))
+	}
+	// Always save back to where we found it
+	j.Dir = dir
+	return &j, nil
+}
+
+func (j *PatchJournal) save() error {
+	b, err := json.MarshalIndent(j, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err = FS.WriteFile(journalPath(j.Dir), b, 0644); err != nil {
+		return fmt.Errorf("Failed to write journal: %w", err)
+	}
+	return nil
+}
+
+func (j *PatchJournal) finish() {
+	for _, p := range j.Cleanup {
+		Log.Debug("Deleting", p)
+		if err := FS.RemoveAll(p); err != nil {
+			Log.Warn("Failed to delete", p+". This is whatever but you might want to delete it manually.", err)
+		}
+	}
+
+	if err := FS.Remove(journalPath(j.Dir)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		Log.Warn("Failed to delete journal", journalPath(j.Dir)+":", err)
+	}
+}
+
+func (j *PatchJournal) doStep(s JournalStep) error {
+	switch s.Op {
+	case StepRename:
+		if !ExistsFile(s.From) && ExistsFile(s.To) {
+			Log.Debug(s.From, "was already renamed to", s.To)
+			return nil
+		}
+		Log.Debug("Renaming", s.From, "to", s.To)
+		if err := FS.Rename(s.From, s.To); err != nil {
+			return CheckIfErrIsCauseItsBusyRn(err)
+		}
+	case StepWriteStub:
+		Log.Debug("Writing custom app.asar to", s.To)
+		return WriteAppAsar(s.To, j.EquicordDirectory)
+	default:
+		return errors.New("Unknown journal step " + s.Op)
+	}
+	return nil
+}
+
+func (j *PatchJournal) undoStep(s JournalStep) error {
+	switch s.Op {
+	case StepRename:
+		if ExistsFile(s.From) || !ExistsFile(s.To) {
+			return nil
+		}
+		Log.Debug("Renaming", s.To, "back to", s.From)
+		return CheckIfErrIsCauseItsBusyRn(FS.Rename(s.To, s.From))
+	case StepWriteStub:
+		Log.Debug("Deleting", s.To)
+		if err := FS.Remove(s.To); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	default:
+		return errors.New("Unknown journal step " + s.Op)
+	}
+	return nil
+}
+
+// Run performs all steps, rolling back on failure
+func (j *PatchJournal) Run() error {
+	if err := j.save(); err != nil {
+		return err
+	}
+
+	if err := j.RollForward(); err != nil {
+		Log.Error("Failed to " + j.Action + ". Undoing partial " + j.Action)
+		if innerErr := j.RollBack(); innerErr != nil {
+			Log.Error("Failed to undo partial "+j.Action+". Rerun the installer to try again, the journal was kept in", journalPath(j.Dir), innerErr)
+		} else {
+			Log.Info("Successfully undid all changes")
+		}
+		return err
+	}
+	return nil
+}
+
+// RollForward performs all steps that are not done yet
+func (j *PatchJournal) RollForward() error {
+	for j.Done < len(j.Steps) {
+		if err := j.doStep(j.Steps[j.Done]); err != nil {
+			return err
+		}
+		j.Done++
+		if err := j.save(); err != nil {
+			return err
+		}
+	}
+
+	j.finish()
+	return nil
+}
+
+// RollBack undoes all steps that were done. Once all steps are done, the
+// action is complete and only cleanup remains, so it rolls forward instead.
+func (j *PatchJournal) RollBack() error {
+	if j.Done >= len(j.Steps) {
+		j.finish()
+		return nil
+	}
+
+	// Steps are marked as done only after they happened, so the current
+	// step may have been done right before a crash. Undoing is idempotent
+	for i := j.Done; i >= 0; i-- {
+		if err := j.undoStep(j.Steps[i]); err != nil {
+			return err
+		}
+		j.Done = i
+		if err := j.save(); err != nil {
+			return err
+		}
+	}
+
+	if err := FS.Remove(journalPath(j.Dir)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		Log.Warn("Failed to delete journal", journalPath(j.Dir)+":", err)
+	}
+	return nil
+}
+
+// attachPendingJournals looks for journals left behind by an interrupted
+// patch or unpatch of any of discords
+func attachPendingJournals(discords []any) {
+	for _, discord := range discords {
+		di := discord.(*DiscordInstall)
+		j, err := ReadJournal(di.patchDir())
+		if err != nil {
+			Log.Warn(err)
+			continue
+		}
+		if j != nil {
+			Log.Warn("Found unfinished", j.Action, "of", di.path, "from", j.StartedAt.Format(time.DateTime))
+			di.journal = j
+		}
+	}
+}
+
+// RecoverJournal finishes (forward) or reverts the interrupted operation on di
+func (di *DiscordInstall) RecoverJournal(forward bool) error {
+	j := di.journal
+	if j == nil {
+		return nil
+	}
+
+	Log.Info(Ternary(forward, "Finishing", "Reverting"), "interrupted", j.Action, "of", di.path+"...")
+	var err error
+	if forward {
+		err = j.RollForward()
+	} else {
+		err = j.RollBack()
+	}
+	if err != nil {
+		return err
+	}
+
+	// RollBack completes actions that were already done
+	completed := forward || j.Done >= len(j.Steps)
+	di.isPatched = (j.Action == "patch") == completed
+	di.journal = nil
+	Log.Info("Successfully recovered", di.path)
+	return nil
+}
+
+// recoverPendingJournal makes sure no interrupted operation is pending before
+// touching di again, recovering automatically if there is one
+func (di *DiscordInstall) recoverPendingJournal() (recovered bool, err error) {
+	if di.journal == nil {
+		if di.journal, err = ReadJournal(di.patchDir()); err != nil {
+			return false, err
+		}
+	}
+	if di.journal == nil {
+		return false, nil
+	}
+	return true, di.RecoverJournalAuto()
+}
+
+// RecoverJournalAuto finishes the interrupted operation if possible and
+// reverts it otherwise
+func (di *DiscordInstall) RecoverJournalAuto() error {
+	if err := di.RecoverJournal(true); err != nil {
+		Log.Warn("Failed to finish interrupted operation, reverting instead:", err)
+		return di.RecoverJournal(false)
+	}
+	return nil
+}
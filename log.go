@@ -1,10 +1,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/fatih/color"
 	"os"
 	"strings"
+	"time"
 )
 
 type Level = int
@@ -36,6 +38,9 @@ var levelColors = map[Level]*color.Color{
 var Log Handler
 var LogLevel = LevelInfo
 
+// LogJSON makes Log print json lines instead, set by the CLI for --json
+var LogJSON bool
+
 func init() {
 	debug := SliceContainsFunc(os.Args, func(s string) bool {
 		return s == "-debug" || s == "--debug"
@@ -44,6 +49,13 @@ func init() {
 	if debug {
 		LogLevel = LevelDebug
 	}
+
+}
+
+type jsonLine struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+	Msg   string    `json:"msg"`
 }
 
 type Handler struct {
@@ -55,7 +67,13 @@ func (h Handler) Log(level Level, a ...any) {
 	}
 
 	levelName := levelNames[level]
-	var prefix any = levelColors[level].Sprintf(levelName + strings.Repeat(" ", len("error")-len(levelName)))
+	if LogJSON {
+		b, _ := json.Marshal(jsonLine{time.Now(), strings.ToLower(levelName), strings.TrimSuffix(fmt.Sprintln(a...), "\n")})
+		_, _ = fmt.Fprintln(os.Stderr, string(b))
+		return
+	}
+
+	var prefix any = levelColors[level].Sprint(levelName + strings.Repeat(" ", len("error")-len(levelName)))
 
 	_, _ = fmt.Fprintln(os.Stderr, Prepend(a, prefix)...)
 }
@@ -0,0 +1,292 @@
+//go:build linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	path "path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memFS is a FileSystem in memory, with the semantics of os on Linux as far
+// as the installer cares
+type memFS struct {
+	files map[string]*memFile
+	temps int
+}
+
+type memFile struct {
+	name string
+	data []byte
+	mode os.FileMode
+	// uid is the owner given by Chown, 0 (root) until then
+	uid int
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: map[string]*memFile{"/": {name: "/", mode: os.ModeDir | 0755}}}
+}
+
+func (m *memFS) get(op, name string) (*memFile, error) {
+	f, ok := m.files[path.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return f, nil
+}
+
+// parent makes sure the directory name goes in exists
+func (m *memFS) parent(op, name string) error {
+	dir, err := m.get(op, path.Dir(path.Clean(name)))
+	if err != nil {
+		return err
+	}
+	if !dir.mode.IsDir() {
+		return &os.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+	}
+	return nil
+}
+
+// children returns the paths below name, at any depth
+func (m *memFS) children(name string) []string {
+	prefix := strings.TrimSuffix(path.Clean(name), "/") + "/"
+	var children []string
+	for p := range m.files {
+		if strings.HasPrefix(p, prefix) {
+			children = append(children, p)
+		}
+	}
+	return children
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	f, err := m.get("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return memFileInfo{f}, nil
+}
+
+func (m *memFS) ReadFile(name string) ([]byte, error) {
+	f, err := m.get("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if f.mode.IsDir() {
+		return nil, &os.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	return bytes.Clone(f.data), nil
+}
+
+func (m *memFS) ReadDir(name string) ([]os.DirEntry, error) {
+	f, err := m.get("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !f.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdirent", Path: name, Err: errors.New("not a directory")}
+	}
+
+	var entries []os.DirEntry
+	for _, p := range m.children(name) {
+		if path.Dir(p) == path.Clean(name) {
+			entries = append(entries, fs.FileInfoToDirEntry(memFileInfo{m.files[p]}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *memFS) Open(name string) (ReadableFile, error) {
+	b, err := m.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return memReader{bytes.NewReader(b)}, nil
+}
+
+func (m *memFS) Rename(from, to string) error {
+	from, to = path.Clean(from), path.Clean(to)
+	f, err := m.get("rename", from)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: os.ErrNotExist}
+	}
+	if err = m.parent("rename", to); err != nil {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: os.ErrNotExist}
+	}
+	if existing, ok := m.files[to]; ok && existing.mode.IsDir() && len(m.children(to)) != 0 {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: errors.New("directory not empty")}
+	}
+
+	children := m.children(from)
+	delete(m.files, from)
+	f.name = to
+	m.files[to] = f
+	for _, p := range children {
+		c := m.files[p]
+		delete(m.files, p)
+		c.name = to + p[len(from):]
+		m.files[c.name] = c
+	}
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	if _, err := m.get("remove", name); err != nil {
+		return err
+	}
+	if len(m.children(name)) != 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+	}
+	delete(m.files, path.Clean(name))
+	return nil
+}
+
+func (m *memFS) RemoveAll(name string) error {
+	for _, p := range m.children(name) {
+		delete(m.files, p)
+	}
+	delete(m.files, path.Clean(name))
+	return nil
+}
+
+func (m *memFS) MkdirAll(name string, perm os.FileMode) error {
+	name = path.Clean(name)
+	if f, ok := m.files[name]; ok {
+		if !f.mode.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: name, Err: errors.New("not a directory")}
+		}
+		return nil
+	}
+	if err := m.MkdirAll(path.Dir(name), perm); err != nil {
+		return err
+	}
+	m.files[name] = &memFile{name: name, mode: os.ModeDir | perm}
+	return nil
+}
+
+func (m *memFS) Chmod(name string, mode os.FileMode) error {
+	f, err := m.get("chmod", name)
+	if err != nil {
+		return err
+	}
+	f.mode = f.mode&os.ModeType | mode.Perm()
+	return nil
+}
+
+func (m *memFS) Chown(name string, uid, _ int) error {
+	f, err := m.get("chown", name)
+	if err == nil {
+		f.uid = uid
+	}
+	return err
+}
+
+func (m *memFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if err := m.parent("open", name); err != nil {
+		return err
+	}
+	if f, ok := m.files[path.Clean(name)]; ok && f.mode.IsDir() {
+		return &os.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	m.files[path.Clean(name)] = &memFile{name: path.Clean(name), data: bytes.Clone(data), mode: perm}
+	return nil
+}
+
+func (m *memFS) Create(name string) (WritableFile, error) {
+	if err := m.WriteFile(name, nil, 0666); err != nil {
+		return nil, err
+	}
+	return &memWriter{m: m, name: path.Clean(name)}, nil
+}
+
+func (m *memFS) CreateTemp(dir, pattern string) (WritableFile, error) {
+	m.temps++
+	name := strconv.Itoa(m.temps)
+	if strings.Contains(pattern, "*") {
+		name = strings.Replace(pattern, "*", name, 1)
+	} else {
+		name = pattern + name
+	}
+	return m.Create(path.Join(dir, name))
+}
+
+func (m *memFS) MkdirTemp(dir, pattern string) (string, error) {
+	m.temps++
+	name := path.Join(dir, strings.Replace(pattern, "*", strconv.Itoa(m.temps), 1))
+	if !strings.Contains(pattern, "*") {
+		name += strconv.Itoa(m.temps)
+	}
+	if err := m.parent("mkdir", name); err != nil {
+		return "", err
+	}
+	if _, ok := m.files[name]; ok {
+		return "", &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	m.files[name] = &memFile{name: name, mode: os.ModeDir | 0700}
+	return name, nil
+}
+
+// mkfile writes data to name, creating the directories it is in
+func (m *memFS) mkfile(name string, data []byte) {
+	if err := m.MkdirAll(path.Dir(name), 0755); err != nil {
+		panic(err)
+	}
+	if err := m.WriteFile(name, data, 0644); err != nil {
+		panic(err)
+	}
+}
+
+type memFileInfo struct {
+	f *memFile
+}
+
+func (i memFileInfo) Name() string       { return path.Base(i.f.name) }
+func (i memFileInfo) Size() int64        { return int64(len(i.f.data)) }
+func (i memFileInfo) Mode() os.FileMode  { return i.f.mode }
+func (i memFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memFileInfo) IsDir() bool        { return i.f.mode.IsDir() }
+func (i memFileInfo) Sys() any           { return nil }
+
+type memReader struct {
+	*bytes.Reader
+}
+
+func (memReader) Close() error {
+	return nil
+}
+
+// memWriter puts what was written in the file as it goes, like a real file
+type memWriter struct {
+	m    *memFS
+	name string
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	f, ok := w.m.files[w.name]
+	if !ok {
+		return 0, &os.PathError{Op: "write", Path: w.name, Err: os.ErrClosed}
+	}
+	f.data = append(f.data, p...)
+	return len(p), nil
+}
+
+func (w *memWriter) Close() error {
+	return nil
+}
+
+func (w *memWriter) Name() string {
+	return w.name
+}
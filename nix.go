@@ -0,0 +1,80 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"errors"
+	path "path/filepath"
+	"strings"
+)
+
+// Installs in the Nix store can't be patched in place, but the package can
+// be patched when it is built. WriteNixOverlay writes a nixpkgs overlay doing
+// what patch does, with the stub app.asar it needs next to it
+
+// nixPackages are the nixpkgs attributes of each branch of Discord
+var nixPackages = map[string]string{
+	"stable":      "discord",
+	"ptb":         "discord-ptb",
+	"canary":      "discord-canary",
+	"development": "discord-development",
+}
+
+const nixOverlayTemplate = `# Patches {attr} to load Bashcord from {bashcord}.
+# Written by the Bashcord installer, run it again rather than editing this.
+# Bashcord is loaded from outside the store, updating it needs no rebuild.
+#
+# NixOS or Home Manager: nixpkgs.overlays = [ (import {overlay}) ];
+# nix-env: ~/.config/nixpkgs/overlays.nix = [ (import {overlay}) ];
+# Flakes can't import it from here, copy it and app.asar into your configuration
+final: prev: {
+  {attr} = prev.{attr}.overrideAttrs (old: {
+    postInstall = (old.postInstall or "") + ''
+      mv $out/opt/{name}/resources/app.asar $out/opt/{name}/resources/_app.asar
+      cp ${./app.asar} $out/opt/{name}/resources/app.asar
+    '';
+  });
+}
+`
+
+// nixOverlayDir is where WriteNixOverlay writes
+func nixOverlayDir() string {
+	return path.Join(BaseDir, "nix")
+}
+
+// WriteNixOverlay writes an overlay patching the nixpkgs package of di and
+// returns its path
+func WriteNixOverlay(di *DiscordInstall) (string, error) {
+	if !di.isNix {
+		return "", errors.New(di.path + " is not in the Nix store")
+	}
+	attr, ok := nixPackages[di.branch]
+	if !ok {
+		return "", errors.New("No nixpkgs package for Discord " + di.branch)
+	}
+
+	dir := nixOverlayDir()
+	if err := FS.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := WriteAppAsar(path.Join(dir, "app.asar"), EquicordDirectory); err != nil {
+		return "", err
+	}
+
+	overlay := path.Join(dir, attr+".nix")
+	contents := strings.NewReplacer(
+		"{attr}", attr,
+		"{bashcord}", EquicordDirectory,
+		"{overlay}", overlay,
+		"{name}", path.Base(di.path),
+	).Replace(nixOverlayTemplate)
+	if err := FS.WriteFile(overlay, []byte(contents), 0644); err != nil {
+		return "", err
+	}
+	_ = FixOwnership(dir)
+	return overlay, nil
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	path "path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteNixOverlay(t *testing.T) {
+	fx := newFixture(t)
+	di := fx.parse(fx.Nix("DiscordPTB"))
+
+	overlay, err := WriteNixOverlay(di)
+	fx.must(err)
+	if overlay != path.Join(BaseDir, "nix", "discord-ptb.nix") {
+		t.Errorf("overlay = %s", overlay)
+	}
+	fx.assertStub(path.Join(BaseDir, "nix", "app.asar"), fixtureBashcord)
+
+	contents := string(fx.read(overlay))
+	for _, want := range []string{
+		"discord-ptb = prev.discord-ptb.overrideAttrs",
+		"mv $out/opt/DiscordPTB/resources/app.asar $out/opt/DiscordPTB/resources/_app.asar",
+		"cp ${./app.asar} $out/opt/DiscordPTB/resources/app.asar",
+	} {
+		if !strings.Contains(contents, want) {
+			t.Errorf("overlay lacks %q:\n%s", want, contents)
+		}
+	}
+
+	if _, err = WriteNixOverlay(fx.parse(fx.Normal("/opt/discord"))); err == nil {
+		t.Error("wrote an overlay for an install outside of the store")
+	}
+}
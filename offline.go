@@ -0,0 +1,211 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	path "path/filepath"
+	"strings"
+)
+
+// maxBundleAsarSize limits the desktop.asar of a bundle, which is read into memory
+const maxBundleAsarSize = 256 * 1024 * 1024
+
+// OfflineInstallRequested reports whether we were started with --from-file or
+// --from-bundle, in which case the network must not be touched at all
+func OfflineInstallRequested() bool {
+	return offlineArg != ""
+}
+
+// InstallOffline installs Bashcord from file, which is either a desktop.asar
+// or a bundle zip, instead of downloading it
+func InstallOffline(file string) error {
+	if strings.EqualFold(path.Ext(file), ".zip") {
+		return InstallFromBundle(file)
+	}
+	return InstallFromFile(file)
+}
+
+// InstallFromFile installs the desktop.asar file. The SHA256SUMS of its
+// release and their signature must be next to it, like in a release, unless
+// BASHCORD_INSECURE_SKIP_VERIFY is set
+func InstallFromFile(file string) error {
+	file, err := path.Abs(file)
+	if err != nil {
+		return err
+	}
+	Log.Info("Installing Bashcord from", file)
+
+	var checksums map[string]string
+	if SkipReleaseVerification {
+		Log.Warn("BASHCORD_INSECURE_SKIP_VERIFY is set, NOT verifying", file+"!")
+	} else if checksums, err = readLocalChecksums(file); err != nil {
+		return err
+	}
+
+	hash, err := ReadEquicordHash(file)
+	if err != nil {
+		return fmt.Errorf("%s is not a Bashcord build: %w", file, err)
+	}
+	return installAsarFile(file, hash, checksums)
+}
+
+// readLocalChecksums verifies and parses the SHA256SUMS next to file
+func readLocalChecksums(file string) (map[string]string, error) {
+	dir := path.Dir(file)
+	sums, err := FS.ReadFile(path.Join(dir, ChecksumsAssetName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.New("No " + ChecksumsAssetName + " next to " + file + ", refusing to install unverified files. Set BASHCORD_INSECURE_SKIP_VERIFY=1 to install anyway")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	checksums, err := checkChecksums(dir, sums, func(name string) ([]byte, error) {
+		sig, err := FS.ReadFile(path.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return sig, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Releases call it desktop.asar, a renamed copy is checked against that
+	if _, ok := checksums[path.Base(file)]; ok {
+		checksums["desktop.asar"] = checksums[path.Base(file)]
+	}
+	return checksums, nil
+}
+
+// installAsarFile installs the Bashcord build file of hash, checking it
+// against checksums unless they are nil
+func installAsarFile(file, hash string, checksums map[string]string) error {
+	err := Exec.Download(LocalFileURL(file), EquicordDirectory, func(part, sha256Hex string) error {
+		if checksums != nil {
+			if err := VerifyChecksum(checksums, "desktop.asar", sha256Hex); err != nil {
+				return err
+			}
+			Log.Debug("desktop.asar checksum is valid")
+		}
+		return checkAsar(part)
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to install %s: %w", file, err)
+	}
+
+	_ = FixOwnership(EquicordDirectory)
+	if ExistsFile(EquicordDirectory + ".prev") {
+		_ = FixOwnership(EquicordDirectory + ".prev")
+	}
+
+	// Keeps patch() from trying to download anything
+	InstalledHash = hash
+	LatestHash = hash
+	Log.Info("Installed Bashcord", hash)
+	return nil
+}
+
+// InstallFromBundle installs the desktop.asar inside the zip bundle, which
+// holds the same files as a release: desktop.asar, SHA256SUMS and its
+// signature, anywhere inside the zip
+func InstallFromBundle(bundle string) error {
+	Log.Info("Installing Bashcord from bundle", bundle)
+
+	r, err := zip.OpenReader(bundle)
+	if err != nil {
+		return fmt.Errorf("Failed to open %s: %w", bundle, err)
+	}
+	defer r.Close()
+
+	files := make(map[string]*zip.File)
+	for _, f := range r.File {
+		name := path.Base(f.Name)
+		// Prefer the least nested one if there are duplicates
+		if f.FileInfo().Mode().IsRegular() && (files[name] == nil || strings.Count(f.Name, "/") < strings.Count(files[name].Name, "/")) {
+			files[name] = f
+		}
+	}
+
+	asarFile := files["desktop.asar"]
+	if asarFile == nil {
+		return errors.New(bundle + " contains no desktop.asar")
+	}
+
+	var checksums map[string]string
+	if SkipReleaseVerification {
+		Log.Warn("BASHCORD_INSECURE_SKIP_VERIFY is set, NOT verifying desktop.asar!")
+	} else {
+		sumsFile := files[ChecksumsAssetName]
+		if sumsFile == nil {
+			return errors.New(bundle + " has no " + ChecksumsAssetName + ", refusing to install unverified files")
+		}
+		sums, err := readZipFile(sumsFile)
+		if err != nil {
+			return err
+		}
+		checksums, err = checkChecksums(bundle, sums, func(name string) ([]byte, error) {
+			if f := files[name]; f != nil {
+				return readZipFile(f)
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Read into memory, so the hash is known even in a dry run that doesn't
+	// write the temp file
+	if asarFile.UncompressedSize64 > maxBundleAsarSize {
+		return errors.New("desktop.asar of " + bundle + " is too large")
+	}
+	src, err := asarFile.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	b, err := io.ReadAll(io.LimitReader(src, maxBundleAsarSize))
+	if err != nil {
+		return fmt.Errorf("Failed to extract desktop.asar from %s: %w", bundle, err)
+	}
+	match := equicordHashRegex.FindSubmatch(b)
+	if match == nil {
+		return errors.New("desktop.asar of " + bundle + " is not a Bashcord build")
+	}
+
+	tmp, err := FS.CreateTemp(path.Dir(EquicordDirectory), ".bashcord-bundle-*.asar")
+	if err != nil {
+		return err
+	}
+	defer FS.Remove(tmp.Name())
+	if _, err = tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return installAsarFile(tmp.Name(), string(match[1]), checksums)
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > maxAssetSize {
+		return nil, errors.New(f.Name + " is too large")
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, maxAssetSize))
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	path "path/filepath"
+	"testing"
+	"vencord/buildinfo"
+)
+
+// signedSums returns a SHA256SUMS of files and its signature, with a key
+// the installer trusts for the duration of the test
+func signedSums(t *testing.T, files map[string][]byte) (sums, sig []byte) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey := buildinfo.ReleasePublicKey
+	t.Cleanup(func() { buildinfo.ReleasePublicKey = oldKey })
+	buildinfo.ReleasePublicKey = base64.StdEncoding.EncodeToString(pub)
+
+	var b bytes.Buffer
+	for name, data := range files {
+		sum := sha256.Sum256(data)
+		b.WriteString(hex.EncodeToString(sum[:]) + "  " + name + "\n")
+	}
+	return b.Bytes(), []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, b.Bytes())))
+}
+
+func TestInstallFromFileVerifies(t *testing.T) {
+	fx := newFixture(t)
+	build := makeAsar("// Equicord 9f8e7d6")
+	file := "/home/user/Downloads/desktop.asar"
+	fx.fs.mkfile(file, build)
+	fx.exec.downloads = map[string][]byte{LocalFileURL(file): build}
+
+	// Nothing to verify it against
+	if err := InstallFromFile(file); err == nil {
+		t.Error("InstallFromFile() without SHA256SUMS succeeded")
+	}
+
+	// Checksums of another file
+	sums, sig := signedSums(t, map[string][]byte{"desktop.asar": makeAsar("// Equicord 1a2b3c4")})
+	fx.fs.mkfile(path.Join(path.Dir(file), ChecksumsAssetName), sums)
+	fx.fs.mkfile(path.Join(path.Dir(file), SignatureAssetName), sig)
+	if err := InstallFromFile(file); err == nil {
+		t.Error("InstallFromFile() of a file not in SHA256SUMS succeeded")
+	}
+	if hash, _ := ReadEquicordHash(EquicordDirectory); hash != "1a2b3c4" || InstalledHash != "1a2b3c4" {
+		t.Fatalf("a refused install replaced Bashcord 1a2b3c4 with %s, installed %s", hash, InstalledHash)
+	}
+
+	sums, sig = signedSums(t, map[string][]byte{"desktop.asar": build})
+	fx.fs.mkfile(path.Join(path.Dir(file), ChecksumsAssetName), sums)
+	fx.fs.mkfile(path.Join(path.Dir(file), SignatureAssetName), sig)
+	fx.must(InstallFromFile(file))
+	if hash, _ := ReadEquicordHash(EquicordDirectory); hash != "9f8e7d6" || InstalledHash != "9f8e7d6" {
+		t.Errorf("installed Bashcord %s, InstalledHash %s, want 9f8e7d6", hash, InstalledHash)
+	}
+}
+
+func TestInstallFromBundleDryRun(t *testing.T) {
+	fx := newFixture(t)
+	oldSkip := SkipReleaseVerification
+	t.Cleanup(func() { SkipReleaseVerification = oldSkip })
+	SkipReleaseVerification = true
+
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, err := zw.Create("bashcord/desktop.asar")
+	fx.must(err)
+	_, err = w.Write(makeAsar("// Equicord 9f8e7d6"))
+	fx.must(err)
+	fx.must(zw.Close())
+	bundle := path.Join(t.TempDir(), "bundle.zip")
+	fx.must(os.WriteFile(bundle, b.Bytes(), 0644))
+
+	EquicordDirectory = path.Join(t.TempDir(), "bashcord.asar")
+	dry := &DryRun{}
+	FS, Exec = dry, dry
+	fx.must(InstallFromBundle(bundle))
+	if InstalledHash != "9f8e7d6" {
+		t.Errorf("InstalledHash = %s, want 9f8e7d6", InstalledHash)
+	}
+	if len(dry.Ops) == 0 || dry.Ops[0].Op != "write" {
+		t.Errorf("dry run ops %v, want the temp file written first", dry.Ops)
+	}
+	if entries, _ := os.ReadDir(path.Dir(EquicordDirectory)); len(entries) != 0 {
+		t.Errorf("the dry run left %d files", len(entries))
+	}
+}
@@ -9,28 +9,23 @@ package main
 import (
 	"bytes"
 	"errors"
-	"io"
-	"net/http"
-	"os"
+	"fmt"
 	path "path/filepath"
-	"strconv"
+	"time"
 )
 
 const OpenAsarDownloadLink = "https://github.com/GooseMod/OpenAsar/releases/download/nightly/app.asar"
 
-func FindAsarFile(dir string) (*os.File, error) {
+// FindAsarFile returns the path of the original asar in dir, _app.asar if
+// patched and app.asar otherwise
+func FindAsarFile(dir string) (string, error) {
 	for _, file := range []string{"_app.asar", "app.asar"} {
-		f, err := os.Open(path.Join(dir, file))
-		if err != nil {
-			continue
-		}
-		stats, err := f.Stat()
-		if err == nil && !stats.IsDir() {
+		f := path.Join(dir, file)
+		if stats, err := FS.Stat(f); err == nil && !stats.IsDir() {
 			return f, nil
 		}
-		_ = f.Close()
 	}
-	return nil, errors.New("Install at " + dir + " has no asar file")
+	return "", errors.New("Install at " + dir + " has no asar file")
 }
 
 func (di *DiscordInstall) IsOpenAsar() (retBool bool) {
@@ -49,8 +44,7 @@ func (di *DiscordInstall) IsOpenAsar() (retBool bool) {
 		return false
 	}
 
-	b, err := io.ReadAll(asarFile)
-	_ = asarFile.Close()
+	b, err := ReadAsarMain(asarFile)
 	if err != nil {
 		Log.Error(err.Error())
 		return false
@@ -64,6 +58,9 @@ func (di *DiscordInstall) IsOpenAsar() (retBool bool) {
 }
 
 func (di *DiscordInstall) InstallOpenAsar() error {
+	if err := di.checkWritable(); err != nil {
+		return err
+	}
 	PreparePatch(di)
 
 	dir := path.Join(di.appPath, "..")
@@ -71,26 +68,23 @@ func (di *DiscordInstall) InstallOpenAsar() error {
 	if err != nil {
 		return err
 	}
-	_ = asarFile.Close()
 
-	if err = os.Rename(asarFile.Name(), path.Join(dir, "app.asar.backup")); err != nil {
-		return err
-	}
+	di.backupBeforeReplacing(asarFile, "openasar")
 
-	res, err := http.Get(OpenAsarDownloadLink)
-	if err != nil {
+	backup := path.Join(dir, "app.asar.backup")
+	if err = FS.Rename(asarFile, backup); err != nil {
 		return err
-	} else if res.StatusCode >= 300 {
-		return errors.New("Failed to fetch OpenAsar - " + strconv.Itoa(res.StatusCode) + ": " + res.Status)
 	}
 
-	outFile, err := os.Create(asarFile.Name())
+	err = Exec.Download(OpenAsarDownloadLink, asarFile, func(file, _ string) error {
+		return checkAsar(file)
+	})
 	if err != nil {
-		return err
-	}
-
-	if _, err = io.Copy(outFile, res.Body); err != nil {
-		return err
+		Log.Error("Failed to fetch OpenAsar, putting", asarFile, "back")
+		if innerErr := FS.Rename(backup, asarFile); innerErr != nil {
+			Log.Error("Failed to put", asarFile, "back. Rename", backup, "to it yourself:", innerErr)
+		}
+		return fmt.Errorf("Failed to fetch OpenAsar: %w", err)
 	}
 
 	di.isOpenAsar = Ptr(true)
@@ -98,6 +92,9 @@ func (di *DiscordInstall) InstallOpenAsar() error {
 }
 
 func (di *DiscordInstall) UninstallOpenAsar() error {
+	if err := di.checkWritable(); err != nil {
+		return err
+	}
 	PreparePatch(di)
 
 	dir := path.Join(di.appPath, "..")
@@ -112,9 +109,8 @@ func (di *DiscordInstall) UninstallOpenAsar() error {
 		if err != nil {
 			return err
 		}
-		_ = asarFile.Close()
 
-		if err = os.Rename(file, asarFile.Name()); err != nil {
+		if err = FS.Rename(file, asarFile); err != nil {
 			return err
 		}
 
@@ -122,5 +118,14 @@ func (di *DiscordInstall) UninstallOpenAsar() error {
 		return nil
 	}
 
-	return errors.New("No app.asar.backup. Reinstall Discord")
+	if b := di.LatestBackup(); b != nil {
+		Log.Info("No app.asar.backup, restoring backup", b.ID, "from", b.CreatedAt.Format(time.DateTime), "instead")
+		if err := di.RestoreBackup(b); err != nil {
+			return err
+		}
+		di.isOpenAsar = Ptr(false)
+		return nil
+	}
+
+	return errors.New("No app.asar.backup and no backup of this install. Reinstall Discord")
 }
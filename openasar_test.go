@@ -0,0 +1,117 @@
+//go:build linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	path "path/filepath"
+	"testing"
+)
+
+func TestFindAsarFile(t *testing.T) {
+	fx := newFixture(t)
+	dir := path.Join(fx.Normal("/opt/discord"), "resources")
+
+	if f, err := FindAsarFile(dir); err != nil || f != path.Join(dir, "app.asar") {
+		t.Errorf("FindAsarFile() = %s, %v, want app.asar", f, err)
+	}
+
+	fx.Patched("/opt/discord")
+	if f, err := FindAsarFile(dir); err != nil || f != path.Join(dir, "_app.asar") {
+		t.Errorf("FindAsarFile() of a patched install = %s, %v, want _app.asar", f, err)
+	}
+
+	if _, err := FindAsarFile("/opt/nothing"); err == nil {
+		t.Error("FindAsarFile() of an empty dir succeeded")
+	}
+}
+
+func TestOpenAsar(t *testing.T) {
+	for _, patched := range []bool{false, true} {
+		t.Run(Ternary(patched, "patched", "unpatched"), func(t *testing.T) {
+			fx := newFixture(t)
+			fx.exec.downloads = map[string][]byte{OpenAsarDownloadLink: fakeOpenAsar}
+			dir := fx.Normal("/opt/discord")
+			if patched {
+				fx.Patched(dir)
+			}
+			di := fx.parse(dir)
+			res := di.patchDir()
+			asarFile := path.Join(res, Ternary(patched, "_app.asar", "app.asar"))
+			original := fx.read(asarFile)
+
+			if di.IsOpenAsar() {
+				t.Fatal("OpenAsar before installing it")
+			}
+
+			fx.must(di.InstallOpenAsar())
+			fx.assertAsar(asarFile, fakeOpenAsar)
+			fx.assertAsar(path.Join(res, "app.asar.backup"), original)
+			if !fx.parse(dir).IsOpenAsar() {
+				t.Error("no OpenAsar after installing it")
+			}
+			if patched {
+				fx.assertStub(path.Join(res, "app.asar"), fixtureBashcord)
+			}
+
+			fx.must(di.UninstallOpenAsar())
+			fx.assertAsar(asarFile, original)
+			fx.assertExists(path.Join(res, "app.asar.backup"), false)
+			if fx.parse(dir).IsOpenAsar() {
+				t.Error("still OpenAsar after uninstalling it")
+			}
+		})
+	}
+}
+
+func TestInstallOpenAsarDownloadFails(t *testing.T) {
+	fx := newFixture(t)
+	di := fx.parse(fx.Normal("/opt/discord"))
+	asarFile := path.Join(di.patchDir(), "app.asar")
+	original := fx.read(asarFile)
+
+	// Downloads nothing
+	if err := di.InstallOpenAsar(); err == nil {
+		t.Fatal("InstallOpenAsar() succeeded without OpenAsar")
+	}
+	fx.assertAsar(asarFile, original)
+	fx.assertExists(path.Join(di.patchDir(), "app.asar.backup"), false)
+
+	// Downloads something that isn't an asar
+	fx.exec.downloads = map[string][]byte{OpenAsarDownloadLink: []byte("<html>rate limited</html>")}
+	if err := di.InstallOpenAsar(); err == nil {
+		t.Fatal("InstallOpenAsar() succeeded with an invalid OpenAsar")
+	}
+	fx.assertAsar(asarFile, original)
+}
+
+func TestUninstallOpenAsarFromBackup(t *testing.T) {
+	fx := newFixture(t)
+	fx.exec.downloads = map[string][]byte{OpenAsarDownloadLink: fakeOpenAsar}
+	di := fx.parse(fx.Normal("/opt/discord"))
+	asarFile := path.Join(di.patchDir(), "app.asar")
+	original := fx.read(asarFile)
+
+	fx.must(di.InstallOpenAsar())
+	// Lost to a Discord update or the user, InstallOpenAsar backed it up anyway
+	fx.must(fx.fs.Remove(path.Join(di.patchDir(), "app.asar.backup")))
+
+	fx.must(di.UninstallOpenAsar())
+	fx.assertAsar(asarFile, original)
+}
+
+func TestUninstallOpenAsarWithoutBackup(t *testing.T) {
+	fx := newFixture(t)
+	di := fx.parse(fx.Normal("/opt/discord"))
+	fx.fs.mkfile(path.Join(di.patchDir(), "app.asar"), fakeOpenAsar)
+
+	if err := di.UninstallOpenAsar(); err == nil {
+		t.Fatalf("UninstallOpenAsar() = %v, want an error", err)
+	}
+	fx.assertAsar(path.Join(di.patchDir(), "app.asar"), fakeOpenAsar)
+}
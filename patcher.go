@@ -7,7 +7,9 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	path "path/filepath"
@@ -56,66 +58,191 @@ type DiscordInstall struct {
 	appPath          string // List of app folder to patch
 	isPatched        bool
 	isFlatpak        bool
+	isSnap           bool // read-only, see ErrReadOnlyInstall
+	isNix            bool // in the read-only Nix store, see ErrReadOnlyInstall
 	isSystemElectron bool // Needs special care https://aur.archlinux.org/packages/discord_arch_electron
 	isOpenAsar       *bool
+	journal          *PatchJournal // left behind by an interrupted patch/unpatch
+	relaunch         *exec.Cmd     // starts again the Discord PreparePatch stopped
+	leaveRunning     bool          // the user told PreparePatch not to stop Discord
 }
 
-//region Patch
+// ErrReadOnlyInstall is returned when changing an install that can't be
+// changed in place. Patch a copy of it instead, see CopyReadOnly
+var ErrReadOnlyInstall = errors.New("read-only install")
 
-func patchAppAsar(dir string, isSystemElectron bool) (err error) {
-	appAsar := path.Join(dir, "app.asar")
-	_appAsar := path.Join(dir, "_app.asar")
+// readOnly returns whether di can't be changed in place
+func (di *DiscordInstall) readOnly() bool {
+	return di.isSnap || di.isNix
+}
 
-	var renamesDone [][]string
-	defer func() {
-		if err != nil && len(renamesDone) > 0 {
-			Log.Error("Failed to patch. Undoing partial patch")
-			for _, rename := range renamesDone {
-				if innerErr := os.Rename(rename[1], rename[0]); innerErr != nil {
-					Log.Error("Failed to undo partial patch. This install is probably bricked.", innerErr)
-				} else {
-					Log.Info("Successfully undid all changes")
-				}
-			}
+// checkWritable returns an ErrReadOnlyInstall explaining why di can't be
+// changed, if it can't
+func (di *DiscordInstall) checkWritable() error {
+	if di.isSnap {
+		return fmt.Errorf("%s is a snap: %w. Snaps are read-only squashfs images mounted by snapd, "+
+			"which replaces them on every update, so the app.asar of Discord can't be swapped. "+
+			"Patch a writable copy of it instead", di.path, ErrReadOnlyInstall)
+	}
+	if di.isNix {
+		return fmt.Errorf("%s is in the Nix store: %w. What is in the store can only be changed by "+
+			"rebuilding the package that put it there. Patch the package with an overlay, or a writable copy of it instead", di.path, ErrReadOnlyInstall)
+	}
+	return nil
+}
+
+// patchDir is the directory containing the app.asar we patch
+func (di *DiscordInstall) patchDir() string {
+	if di.isSystemElectron {
+		return di.path
+	}
+	return path.Join(di.appPath, "..")
+}
+
+// BuildInfo is the build_info.json Discord has next to its app.asar
+type BuildInfo struct {
+	ReleaseChannel string `json:"releaseChannel"`
+	Version        string `json:"version"`
+}
+
+// ReadBuildInfo reads the build_info.json in dir. Nil if there is none
+func ReadBuildInfo(dir string) *BuildInfo {
+	b, err := FS.ReadFile(path.Join(dir, "build_info.json"))
+	if err != nil {
+		return nil
+	}
+	var buildInfo BuildInfo
+	if json.Unmarshal(b, &buildInfo) != nil {
+		return nil
+	}
+	return &buildInfo
+}
+
+// DiscordVersion returns the version of Discord from its build_info.json or,
+// on Windows, from the app-x.y.z folder. Empty if unknown
+func (di *DiscordInstall) DiscordVersion() string {
+	if buildInfo := ReadBuildInfo(di.patchDir()); buildInfo != nil && buildInfo.Version != "" {
+		return buildInfo.Version
+	}
+
+	for _, dir := range strings.Split(path.ToSlash(di.appPath), "/") {
+		if strings.HasPrefix(dir, "app-") {
+			return dir[len("app-"):]
 		}
-	}()
+	}
+	return ""
+}
 
-	Log.Debug("Renaming", appAsar, "to", _appAsar)
-	if err := os.Rename(appAsar, _appAsar); err != nil {
-		err = CheckIfErrIsCauseItsBusyRn(err)
-		Log.Error(err.Error())
-		return err
+// AsarTarget returns the Bashcord asar the stub app.asar of di loads. Empty if
+// di isn't patched
+func (di *DiscordInstall) AsarTarget() (string, error) {
+	if !di.isPatched {
+		return "", nil
 	}
-	renamesDone = append(renamesDone, []string{appAsar, _appAsar})
+	return ReadAppAsarTarget(path.Join(di.patchDir(), "app.asar"))
+}
 
-	if isSystemElectron {
-		from, to := appAsar+".unpacked", _appAsar+".unpacked"
-		Log.Debug("Renaming", from, "to", to)
-		err := os.Rename(from, to)
-		if err != nil {
-			return err
+// flatpakID returns the flatpak app id of di, like com.discordapp.Discord
+func (di *DiscordInstall) flatpakID() string {
+	for _, e := range strings.Split(di.path, "/") {
+		if strings.HasPrefix(e, "com.discordapp") {
+			return e
 		}
-		renamesDone = append(renamesDone, []string{from, to})
 	}
+	return ""
+}
 
-	Log.Debug("Writing custom app.asar to", appAsar)
-	if err := WriteAppAsar(appAsar, EquicordDirectory); err != nil {
+// LaunchDiscord starts Discord from di, as the user who ran us with sudo if
+// there is one
+func (di *DiscordInstall) LaunchDiscord() error {
+	cmd, err := launchCommand(di)
+	if err != nil {
 		return err
 	}
+	Log.Info("Launching Discord", di.path)
+	return Exec.Start(cmd)
+}
+
+// realUserArgs returns the arguments of su running cmdline as the user who ran
+// us with sudo. su - drops the environment, so the variables in keepEnv are
+// set again by env in cmdline. --whitelist-environment would do, but only the
+// su of util-linux has it, not those of shadow or busybox
+func realUserArgs(cmdline string, keepEnv ...string) []string {
+	actualUser := os.Getenv("SUDO_USER")
+	Log.Debug("We are root. Using su to run as", actualUser)
+	var env []string
+	for _, name := range keepEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	if len(env) != 0 {
+		cmdline = "env " + shellQuote(env) + " " + cmdline
+	}
+	return []string{"-", actualUser, "-c", "sh", "-c", cmdline}
+}
+
+// RelaunchDiscord starts again the Discord that PreparePatch stopped, if any
+func (di *DiscordInstall) RelaunchDiscord() error {
+	cmd := di.relaunch
+	if cmd == nil {
+		return nil
+	}
+	di.relaunch = nil
+	Log.Info("Relaunching Discord", di.path)
+	return Exec.Start(cmd)
+}
+
+//region Patch
+
+// patchAppAsar replaces the app.asar in dir with a stub loading the Bashcord
+// asar at bashcord
+func patchAppAsar(dir string, isSystemElectron bool, bashcord string) error {
+	appAsar := path.Join(dir, "app.asar")
+	_appAsar := path.Join(dir, "_app.asar")
+
+	steps := []JournalStep{{Op: StepRename, From: appAsar, To: _appAsar}}
+	if isSystemElectron {
+		steps = append(steps, JournalStep{Op: StepRename, From: appAsar + ".unpacked", To: _appAsar + ".unpacked"})
+	}
+	steps = append(steps, JournalStep{Op: StepWriteStub, To: appAsar})
 
+	j := newJournal("patch", dir, isSystemElectron, steps)
+	j.EquicordDirectory = bashcord
+	if err := j.Run(); err != nil {
+		Log.Error(err.Error())
+		return err
+	}
 	return nil
 }
 
 func (di *DiscordInstall) patch() error {
-	Log.Info("Patching " + di.path + "...")
+	// Before downloading anything for nothing
+	if err := di.checkWritable(); err != nil {
+		return err
+	}
 	if LatestHash != InstalledHash {
 		if err := InstallLatestBuilds(); err != nil {
-			return nil // already shown dialog so don't return same error again
+			return fmt.Errorf("Failed to install the latest Bashcord: %w", err)
 		}
 	}
+	return di.patchWith(EquicordDirectory)
+}
+
+// patchWith patches di to load the Bashcord asar at bashcord, which is
+// expected to be there already
+func (di *DiscordInstall) patchWith(bashcord string) error {
+	Log.Info("Patching " + di.path + "...")
+	if err := di.checkWritable(); err != nil {
+		return err
+	}
 
 	PreparePatch(di)
 
+	if _, err := di.recoverPendingJournal(); err != nil {
+		return err
+	}
+
 	if di.isPatched {
 		Log.Info(di.path, "is already patched. Unpatching first...")
 		if err := di.unpatch(); err != nil {
@@ -126,37 +253,26 @@ func (di *DiscordInstall) patch() error {
 		}
 	}
 
-	if di.isSystemElectron {
-		if err := patchAppAsar(di.path, true); err != nil {
-			return err
-		}
-	} else {
-		if err := patchAppAsar(path.Join(di.appPath, ".."), false); err != nil {
-			return err
-		}
+	di.backupBeforeReplacing(path.Join(di.patchDir(), "app.asar"), "patch")
+
+	if err := patchAppAsar(di.patchDir(), di.isSystemElectron, bashcord); err != nil {
+		return err
 	}
 
 	Log.Info("Successfully patched", di.path)
 	di.isPatched = true
 
 	if di.isFlatpak {
-		pathElements := strings.Split(di.path, "/")
-		var name string
-		for _, e := range pathElements {
-			if strings.HasPrefix(e, "com.discordapp") {
-				name = e
-				break
-			}
-		}
+		name := di.flatpakID()
 
-		Log.Debug("This is a flatpak. Trying to grant the Flatpak access to", EquicordDirectory+"...")
+		Log.Debug("This is a flatpak. Trying to grant the Flatpak access to", bashcord+"...")
 
 		isSystemFlatpak := strings.HasPrefix(di.path, "/var")
 		var args []string
 		if !isSystemFlatpak {
 			args = append(args, "--user")
 		}
-		args = append(args, "override", name, "--filesystem="+EquicordDirectory)
+		args = append(args, "override", name, "--filesystem="+bashcord)
 		fullCmd := "flatpak " + strings.Join(args, " ")
 
 		Log.Debug("Running", fullCmd)
@@ -164,20 +280,12 @@ func (di *DiscordInstall) patch() error {
 		var err error
 		if !isSystemFlatpak && os.Getuid() == 0 {
 			// We are operating on a user flatpak but are root
-			actualUser := os.Getenv("SUDO_USER")
-			Log.Debug("This is a user install but we are root. Using su to run as", actualUser)
-			cmd := exec.Command("su", "-", actualUser, "-c", "sh", "-c", fullCmd)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			err = cmd.Run()
+			err = Exec.Run("su", realUserArgs(fullCmd)...)
 		} else {
-			cmd := exec.Command("flatpak", args...)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			err = cmd.Run()
+			err = Exec.Run("flatpak", args...)
 		}
 		if err != nil {
-			return errors.New("Failed to grant Discord Flatpak access to " + EquicordDirectory + ": " + err.Error())
+			return errors.New("Failed to grant Discord Flatpak access to " + bashcord + ": " + err.Error())
 		}
 	}
 	return nil
@@ -187,70 +295,46 @@ func (di *DiscordInstall) patch() error {
 
 // region Unpatch
 
-func unpatchAppAsar(dir string, isSystemElectron bool) (errOut error) {
+func unpatchAppAsar(dir string, isSystemElectron bool) error {
 	appAsar := path.Join(dir, "app.asar")
 	appAsarTmp := path.Join(dir, "app.asar.tmp")
 	_appAsar := path.Join(dir, "_app.asar")
 
-	var renamesDone [][]string
-	defer func() {
-		if errOut != nil && len(renamesDone) > 0 {
-			Log.Error("Failed to unpatch. Undoing partial unpatch")
-			for _, rename := range renamesDone {
-				if innerErr := os.Rename(rename[1], rename[0]); innerErr != nil {
-					Log.Error("Failed to undo partial unpatch. This install is probably bricked.", innerErr)
-				} else {
-					Log.Info("Successfully undid all changes")
-				}
-			}
-		} else if errOut == nil {
-			if innerErr := os.RemoveAll(appAsarTmp); innerErr != nil {
-				Log.Warn("Failed to delete temporary app.asar (patch folder) backup. This is whatever but you might want to delete it manually.", innerErr)
-			}
-		}
-	}()
-
-	Log.Debug("Deleting", appAsar)
-	if err := os.Rename(appAsar, appAsarTmp); err != nil {
-		err = CheckIfErrIsCauseItsBusyRn(err)
-		Log.Error(err.Error())
-		errOut = err
-	} else {
-		renamesDone = append(renamesDone, []string{appAsar, appAsarTmp})
+	steps := []JournalStep{
+		{Op: StepRename, From: appAsar, To: appAsarTmp},
+		{Op: StepRename, From: _appAsar, To: appAsar},
 	}
-
-	Log.Debug("Renaming", _appAsar, "to", appAsar)
-	if err := os.Rename(_appAsar, appAsar); err != nil {
-		err = CheckIfErrIsCauseItsBusyRn(err)
-		Log.Error(err.Error())
-		errOut = err
-	} else {
-		renamesDone = append(renamesDone, []string{_appAsar, appAsar})
+	if isSystemElectron {
+		steps = append(steps, JournalStep{Op: StepRename, From: _appAsar + ".unpacked", To: appAsar + ".unpacked"})
 	}
 
-	if isSystemElectron {
-		Log.Debug("Renaming", _appAsar+".unpacked", "to", appAsar+".unpacked")
-		if err := os.Rename(_appAsar+".unpacked", appAsar+".unpacked"); err != nil {
-			Log.Error(err.Error())
-			errOut = err
-		}
+	j := newJournal("unpatch", dir, isSystemElectron, steps)
+	// The patch folder backup is only deleted once everything else succeeded
+	j.Cleanup = []string{appAsarTmp}
+	if err := j.Run(); err != nil {
+		Log.Error(err.Error())
+		return err
 	}
-	return
+	return nil
 }
 
 func (di *DiscordInstall) unpatch() error {
 	Log.Info("Unpatching " + di.path + "...")
+	if err := di.checkWritable(); err != nil {
+		return err
+	}
 
 	PreparePatch(di)
 
-	if di.isSystemElectron {
-		if err := unpatchAppAsar(di.path, true); err != nil {
-			return err
-		}
-	} else {
-		if err := unpatchAppAsar(path.Join(di.appPath, ".."), false); err != nil {
-			return err
-		}
+	if recovered, err := di.recoverPendingJournal(); err != nil {
+		return err
+	} else if recovered && !di.isPatched {
+		Log.Info("Successfully unpatched", di.path)
+		return nil
+	}
+
+	if err := unpatchAppAsar(di.patchDir(), di.isSystemElectron); err != nil {
+		return err
 	}
 
 	Log.Info("Successfully unpatched", di.path)
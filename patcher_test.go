@@ -0,0 +1,214 @@
+//go:build linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	path "path/filepath"
+	"testing"
+)
+
+func TestPatchUnpatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout func(fx *fixture) string
+		// override is the flatpak override patch runs, if any
+		override string
+	}{
+		{name: "normal", layout: func(fx *fixture) string { return fx.Normal("/opt/discord") }},
+		{name: "system electron", layout: func(fx *fixture) string { return fx.SystemElectron("/usr/lib/discord") }},
+		{
+			name:     "flatpak user",
+			layout:   func(fx *fixture) string { return fx.Flatpak("Discord", false) },
+			override: "flatpak --user override com.discordapp.Discord --filesystem=" + fixtureBashcord,
+		},
+		{
+			name:     "flatpak system",
+			layout:   func(fx *fixture) string { return fx.Flatpak("DiscordCanary", true) },
+			override: "flatpak override com.discordapp.DiscordCanary --filesystem=" + fixtureBashcord,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fx := newFixture(t)
+			di := fx.parse(tt.layout(fx))
+			dir := di.patchDir()
+			original := fx.read(path.Join(dir, "app.asar"))
+
+			fx.must(di.patch())
+			if !di.isPatched || !fx.parse(di.path).isPatched {
+				t.Fatal("not patched after patch")
+			}
+			fx.assertAsar(path.Join(dir, "_app.asar"), original)
+			fx.assertStub(path.Join(dir, "app.asar"), fixtureBashcord)
+			fx.assertExists(journalPath(dir), false)
+			if di.isSystemElectron {
+				fx.assertExists(path.Join(dir, "_app.asar.unpacked", "discord_native.node"), true)
+				fx.assertExists(path.Join(dir, "app.asar.unpacked"), false)
+			}
+
+			override := tt.override
+			if override != "" && di.path[:4] != "/var" && os.Getuid() == 0 {
+				override = "su - " + os.Getenv("SUDO_USER") + " -c sh -c " + override
+			}
+			if override == "" && len(fx.exec.runs) != 0 || override != "" && (len(fx.exec.runs) != 1 || fx.exec.runs[0] != override) {
+				t.Errorf("ran %q, want %q", fx.exec.runs, override)
+			}
+
+			fx.must(di.unpatch())
+			if di.isPatched || fx.parse(di.path).isPatched {
+				t.Fatal("still patched after unpatch")
+			}
+			fx.assertAsar(path.Join(dir, "app.asar"), original)
+			for _, f := range []string{"_app.asar", "app.asar.tmp", "_app.asar.unpacked", JournalFileName} {
+				fx.assertExists(path.Join(dir, f), false)
+			}
+			if di.isSystemElectron {
+				fx.assertExists(path.Join(dir, "app.asar.unpacked", "discord_native.node"), true)
+			}
+		})
+	}
+}
+
+func TestPatchAlreadyPatched(t *testing.T) {
+	fx := newFixture(t)
+	di := fx.parse(fx.Patched(fx.Normal("/opt/discord")))
+	dir := di.patchDir()
+	original := fx.read(path.Join(dir, "_app.asar"))
+
+	// Patching again with another Bashcord points the stub at it
+	EquicordDirectory = "/opt/bashcord/bashcord.asar"
+	fx.must(di.patch())
+	fx.assertAsar(path.Join(dir, "_app.asar"), original)
+	fx.assertStub(path.Join(dir, "app.asar"), EquicordDirectory)
+	fx.assertExists(path.Join(dir, "app.asar.tmp"), false)
+}
+
+func TestPatchFailedDownload(t *testing.T) {
+	fx := newFixture(t)
+	oldRelease := ReleaseData
+	t.Cleanup(func() { ReleaseData = oldRelease })
+	ReleaseData = GithubRelease{TagName: "v2"}
+	LatestHash = "9f8e7d6"
+	di := fx.parse(fx.Normal("/opt/discord"))
+
+	if err := di.patch(); err == nil {
+		t.Fatal("patch() succeeded without desktop.asar to download")
+	}
+	fx.assertExists(path.Join(di.patchDir(), "_app.asar"), false)
+}
+
+func TestPatchRollback(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout func(fx *fixture) string
+		fault  *faultFS
+	}{
+		{
+			name:   "first rename",
+			layout: func(fx *fixture) string { return fx.Normal("/opt/discord") },
+			fault:  &faultFS{failRenames: map[int]bool{1: true}},
+		},
+		{
+			// app.asar is already moved when app.asar.unpacked fails
+			name:   "system electron second rename",
+			layout: func(fx *fixture) string { return fx.SystemElectron("/usr/lib/discord") },
+			fault:  &faultFS{failRenames: map[int]bool{2: true}},
+		},
+		{
+			name:   "stub write",
+			layout: func(fx *fixture) string { return fx.Normal("/opt/discord") },
+			fault:  &faultFS{failWrite: "app.asar"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fx := newFixture(t)
+			di := fx.parse(tt.layout(fx))
+			dir := di.patchDir()
+			original := fx.read(path.Join(dir, "app.asar"))
+
+			fx.inject(dir, tt.fault)
+			if err := di.patch(); !errors.Is(err, errInjected) {
+				t.Fatalf("patch() = %v, want the injected failure", err)
+			}
+
+			if di.isPatched || fx.parse(di.path).isPatched {
+				t.Error("patched after a failed patch")
+			}
+			fx.assertAsar(path.Join(dir, "app.asar"), original)
+			for _, f := range []string{"_app.asar", "_app.asar.unpacked", JournalFileName} {
+				fx.assertExists(path.Join(dir, f), false)
+			}
+			if di.isSystemElectron {
+				fx.assertExists(path.Join(dir, "app.asar.unpacked", "discord_native.node"), true)
+			}
+		})
+	}
+}
+
+func TestUnpatchRollback(t *testing.T) {
+	for _, systemElectron := range []bool{false, true} {
+		t.Run(Ternary(systemElectron, "system electron", "normal"), func(t *testing.T) {
+			fx := newFixture(t)
+			di := fx.parse(fx.Patched(Ternary(systemElectron, fx.SystemElectron, fx.Normal)("/opt/discord")))
+			dir := di.patchDir()
+			original := fx.read(path.Join(dir, "_app.asar"))
+
+			// The stub is already moved to app.asar.tmp when putting _app.asar back fails
+			fx.inject(dir, &faultFS{failRenames: map[int]bool{2: true}})
+			if err := di.unpatch(); !errors.Is(err, errInjected) {
+				t.Fatalf("unpatch() = %v, want the injected failure", err)
+			}
+
+			if !di.isPatched || !fx.parse(di.path).isPatched {
+				t.Error("not patched anymore after a failed unpatch")
+			}
+			fx.assertAsar(path.Join(dir, "_app.asar"), original)
+			fx.assertStub(path.Join(dir, "app.asar"), fixtureBashcord)
+			fx.assertExists(path.Join(dir, "app.asar.tmp"), false)
+			fx.assertExists(journalPath(dir), false)
+		})
+	}
+}
+
+func TestFailedRollbackIsRecovered(t *testing.T) {
+	fx := newFixture(t)
+	di := fx.parse(fx.Patched(fx.Normal("/opt/discord")))
+	dir := di.patchDir()
+	original := fx.read(path.Join(dir, "_app.asar"))
+
+	// Putting _app.asar back fails, and so does moving the stub back after it
+	fx.inject(dir, &faultFS{failRenames: map[int]bool{2: true, 3: true}})
+	if err := di.unpatch(); !errors.Is(err, errInjected) {
+		t.Fatalf("unpatch() = %v, want the injected failure", err)
+	}
+	fx.assertExists(path.Join(dir, "app.asar"), false)
+	fx.assertExists(journalPath(dir), true)
+
+	// The next run finds the journal and finishes the unpatch
+	FS = fx.fs
+	di = fx.parse(di.path)
+	attachPendingJournals([]any{di})
+	if di.journal == nil {
+		t.Fatal("journal of the failed unpatch not found")
+	}
+	fx.must(di.RecoverJournalAuto())
+
+	if di.isPatched || fx.parse(di.path).isPatched {
+		t.Error("still patched after recovering the unpatch")
+	}
+	fx.assertAsar(path.Join(dir, "app.asar"), original)
+	for _, f := range []string{"_app.asar", "app.asar.tmp", JournalFileName} {
+		fx.assertExists(path.Join(dir, f), false)
+	}
+}
@@ -0,0 +1,250 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	path "path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// How long Discord gets to quit after SIGTERM before it is killed
+const killTimeout = 10 * time.Second
+
+var procDir = "/proc"
+
+var killLock sync.Mutex
+
+// DiscordProcess is a running process of a Discord install
+type DiscordProcess struct {
+	Pid  int
+	PPid int
+	// Exe is the binary being run, as seen from inside its mount namespace.
+	// Flatpak ones are in /app
+	Exe    string
+	Args   []string
+	Dir    string
+	Env    []string
+	Uid    int
+	Gid    int
+	Groups []uint32
+}
+
+// PreparePatch stops the running Discord of di, if the user agrees. Patching
+// under a running Discord leaves it with the old asar mapped, and it may write
+// over the patch when it quits or updates
+func PreparePatch(di *DiscordInstall) {
+	killLock.Lock()
+	defer killLock.Unlock()
+
+	if di.leaveRunning {
+		return
+	}
+	procs := FindDiscordProcesses(di)
+	if len(procs) == 0 {
+		return
+	}
+	Log.Debug("Discord is running from", di.path, "as", len(procs), "process(es)")
+
+	if !ConfirmKillDiscord(di) {
+		Log.Debug("Leaving Discord running")
+		di.leaveRunning = true
+		return
+	}
+	if err := StopDiscord(di, procs); err != nil {
+		Log.Warn("Failed to stop Discord:", err)
+	}
+}
+
+// DiscordRunning returns whether di is running
+func DiscordRunning(di *DiscordInstall) bool {
+	return len(FindDiscordProcesses(di)) > 0
+}
+
+// FindDiscordProcesses returns the processes running di, parents first
+func FindDiscordProcesses(di *DiscordInstall) []*DiscordProcess {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		Log.Warn("Failed to list processes:", err)
+		return nil
+	}
+
+	// The path of the install as the kernel reports it, symlinks resolved
+	realPath, err := path.EvalSymlinks(di.path)
+	if err != nil {
+		realPath = di.path
+	}
+
+	var procs []*DiscordProcess
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		// Processes come and go while we look, and we may not be allowed to
+		// look at those of others
+		p, err := readProcess(pid)
+		if err != nil {
+			continue
+		}
+		if di.isFlatpak && readFlatpakID(pid) == di.flatpakID() || !di.isFlatpak && runsFrom(p, realPath, di.isSystemElectron) {
+			procs = append(procs, p)
+		}
+	}
+
+	sort.Slice(procs, func(i, j int) bool { return procs[i].Pid < procs[j].Pid })
+	return procs
+}
+
+// runsFrom returns whether p runs the install at dir
+func runsFrom(p *DiscordProcess, dir string, isSystemElectron bool) bool {
+	if isUnder(p.Exe, dir) {
+		return true
+	}
+	// System electron runs the electron of the system, with our app.asar as argument
+	return isSystemElectron && len(p.Args) > 1 && SliceContainsFunc(p.Args[1:], func(arg string) bool {
+		return isUnder(arg, dir)
+	})
+}
+
+func isUnder(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+func readProcess(pid int) (*DiscordProcess, error) {
+	dir := path.Join(procDir, strconv.Itoa(pid))
+
+	stat, err := os.ReadFile(path.Join(dir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	// pid (comm) state ppid ..., where comm may contain anything
+	i := bytes.LastIndexByte(stat, ')')
+	fields := strings.Fields(string(stat[i+1:]))
+	if i == -1 || len(fields) < 2 {
+		return nil, errors.New("Invalid " + path.Join(dir, "stat"))
+	}
+	if fields[0] == "Z" {
+		return nil, errors.New("Process " + strconv.Itoa(pid) + " is a zombie")
+	}
+
+	exe, err := os.Readlink(path.Join(dir, "exe"))
+	if err != nil {
+		return nil, err
+	}
+	cmdline, err := os.ReadFile(path.Join(dir, "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	status, err := os.ReadFile(path.Join(dir, "status"))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &DiscordProcess{
+		Pid:  pid,
+		Exe:  strings.TrimSuffix(exe, " (deleted)"),
+		Args: splitNul(cmdline),
+		Uid:  -1,
+		Gid:  -1,
+	}
+	p.PPid, _ = strconv.Atoi(fields[1])
+	p.Dir, _ = os.Readlink(path.Join(dir, "cwd"))
+	if environ, err := os.ReadFile(path.Join(dir, "environ")); err == nil {
+		p.Env = splitNul(environ)
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		key, value, _ := strings.Cut(line, ":")
+		ids := strings.Fields(value)
+		switch {
+		case key == "Uid" && len(ids) != 0:
+			p.Uid, _ = strconv.Atoi(ids[0])
+		case key == "Gid" && len(ids) != 0:
+			p.Gid, _ = strconv.Atoi(ids[0])
+		case key == "Groups":
+			for _, id := range ids {
+				if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+					p.Groups = append(p.Groups, uint32(g))
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// readFlatpakID returns the flatpak app id of the sandbox pid runs in, if any
+func readFlatpakID(pid int) string {
+	b, err := os.ReadFile(path.Join(procDir, strconv.Itoa(pid), "root", ".flatpak-info"))
+	if err != nil {
+		return ""
+	}
+	inApplication := false
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inApplication = line == "[Application]"
+		} else if name, ok := strings.CutPrefix(line, "name="); ok && inApplication {
+			return name
+		}
+	}
+	return ""
+}
+
+func splitNul(b []byte) []string {
+	b = bytes.TrimRight(b, "\x00")
+	if len(b) == 0 {
+		return nil
+	}
+	return strings.Split(string(b), "\x00")
+}
+
+// StopDiscord terminates procs, the running Discord of di, remembering how to
+// start it again for RelaunchDiscord
+func StopDiscord(di *DiscordInstall, procs []*DiscordProcess) error {
+	Log.Info("Closing Discord", di.path+"...")
+	if err := Exec.Terminate(SliceMap(procs, func(p *DiscordProcess) int { return p.Pid }), killTimeout); err != nil {
+		return err
+	}
+	di.relaunch = relaunchCommand(di, procs)
+	return nil
+}
+
+// relaunchCommand returns the command starting the Discord that ran as procs
+func relaunchCommand(di *DiscordInstall, procs []*DiscordProcess) *exec.Cmd {
+	pids := make(map[int]bool)
+	for _, p := range procs {
+		pids[p.Pid] = true
+	}
+	// The main process is the first one not started by another Discord process
+	main := procs[max(0, SliceIndexFunc(procs, func(p *DiscordProcess) bool { return !pids[p.PPid] }))]
+
+	var cmd *exec.Cmd
+	if di.isFlatpak {
+		// What runs in the sandbox can't be started from outside of it
+		cmd = exec.Command("flatpak", "run", di.flatpakID())
+	} else {
+		cmd = exec.Command(main.Exe)
+		cmd.Args = main.Args
+		cmd.Dir = main.Dir
+	}
+	// Its environment has the DISPLAY and friends we may lack when run with sudo
+	cmd.Env = main.Env
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	// Don't start Discord as root when we are run with sudo
+	if os.Geteuid() == 0 && main.Uid > 0 {
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(main.Uid), Gid: uint32(main.Gid), Groups: main.Groups}
+	}
+	return cmd
+}
@@ -0,0 +1,116 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"os"
+	path "path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeProcess adds a process to the fake /proc of the fixture. flatpakID is
+// the app whose sandbox it runs in, if any
+func (fx *fixture) fakeProcess(pid, ppid int, exe, flatpakID string, args ...string) {
+	dir := path.Join(procDir, strconv.Itoa(pid))
+	files := map[string]string{
+		"stat":    strconv.Itoa(pid) + " (" + path.Base(exe) + ") S " + strconv.Itoa(ppid) + " 1 1 0 -1",
+		"cmdline": strings.Join(Prepend(args, exe), "\x00") + "\x00",
+		"environ": "DISPLAY=:0\x00HOME=/home/user\x00",
+		"status":  "Name:\t" + path.Base(exe) + "\nUid:\t1000\t1000\t1000\t1000\nGid:\t1000\t1000\t1000\t1000\nGroups:\t27 44 1000 \n",
+	}
+	if flatpakID != "" {
+		files["root/.flatpak-info"] = "[Application]\nname=" + flatpakID + "\nruntime=runtime/org.freedesktop.Platform/x86_64/23.08\n"
+	}
+	for name, content := range files {
+		fx.must(os.MkdirAll(path.Dir(path.Join(dir, name)), 0755))
+		fx.must(os.WriteFile(path.Join(dir, name), []byte(content), 0644))
+	}
+	fx.must(os.Symlink(exe, path.Join(dir, "exe")))
+	fx.must(os.Symlink("/home/user", path.Join(dir, "cwd")))
+}
+
+func TestFindDiscordProcesses(t *testing.T) {
+	fx := newFixture(t)
+	normal := fx.parse(fx.Normal("/opt/discord"))
+	canary := fx.parse(fx.Normal("/opt/discord-canary"))
+	systemElectron := fx.parse(fx.SystemElectron("/usr/lib/discord"))
+	flatpak := fx.parse(fx.Flatpak("Discord", false))
+
+	fx.fakeProcess(100, 1, "/opt/discord/Discord", "")
+	fx.fakeProcess(101, 100, "/opt/discord/Discord", "", "--type=zygote")
+	// Updated under its feet
+	fx.fakeProcess(102, 101, "/opt/discord/Discord (deleted)", "", "--type=renderer")
+	fx.fakeProcess(200, 1, "/usr/lib/electron28/electron", "", "/usr/lib/discord/app.asar")
+	fx.fakeProcess(201, 1, "/usr/lib/electron28/electron", "", "/opt/vscode/resources/app")
+	fx.fakeProcess(300, 299, "/app/discord/Discord", "com.discordapp.Discord")
+	fx.fakeProcess(301, 1, "/app/bin/other", "com.example.Other")
+	fx.fakeProcess(400, 1, "/opt/discord-canary-not/Discord", "")
+
+	for _, tt := range []struct {
+		di   *DiscordInstall
+		pids []int
+	}{
+		{normal, []int{100, 101, 102}},
+		{canary, nil},
+		{systemElectron, []int{200}},
+		{flatpak, []int{300}},
+	} {
+		pids := SliceMap(FindDiscordProcesses(tt.di), func(p *DiscordProcess) int { return p.Pid })
+		if len(pids)+len(tt.pids) != 0 && !reflect.DeepEqual(pids, tt.pids) {
+			t.Errorf("FindDiscordProcesses(%s) = %v, want %v", tt.di.path, pids, tt.pids)
+		}
+	}
+}
+
+func TestStopAndRelaunchDiscord(t *testing.T) {
+	fx := newFixture(t)
+	normal := fx.parse(fx.Normal("/opt/discord"))
+	flatpak := fx.parse(fx.Flatpak("DiscordCanary", true))
+
+	fx.fakeProcess(100, 1, "/opt/discord/Discord", "", "--start-minimized")
+	fx.fakeProcess(101, 100, "/opt/discord/Discord", "", "--type=renderer")
+	fx.fakeProcess(300, 299, "/app/discord-canary/DiscordCanary", "com.discordapp.DiscordCanary")
+
+	fx.must(StopDiscord(normal, FindDiscordProcesses(normal)))
+	fx.must(StopDiscord(flatpak, FindDiscordProcesses(flatpak)))
+	if cmd := normal.relaunch; cmd == nil || cmd.Dir != "/home/user" || !SliceContains(cmd.Env, "DISPLAY=:0") {
+		t.Errorf("relaunch command = %+v, want it run in the directory and environment of Discord", cmd)
+	}
+	fx.must(normal.RelaunchDiscord())
+	fx.must(flatpak.RelaunchDiscord())
+	// Only once
+	fx.must(normal.RelaunchDiscord())
+
+	want := []string{
+		"terminate 100 101",
+		"terminate 300",
+		"start /opt/discord/Discord --start-minimized",
+		"start flatpak run com.discordapp.DiscordCanary",
+	}
+	if !reflect.DeepEqual(fx.exec.runs, want) {
+		t.Errorf("ran %q, want %q", fx.exec.runs, want)
+	}
+}
+
+func TestRealUserArgsKeepsEnv(t *testing.T) {
+	t.Setenv("SUDO_USER", "user")
+	t.Setenv("DISPLAY", ":0")
+	t.Setenv("XAUTHORITY", "/home/user/.Xauthority")
+	// Restored after the test
+	t.Setenv("WAYLAND_DISPLAY", "")
+	os.Unsetenv("WAYLAND_DISPLAY")
+
+	// Through env, as only some su have --whitelist-environment
+	got := realUserArgs("'/opt/discord/Discord'", "DISPLAY", "WAYLAND_DISPLAY", "XAUTHORITY")
+	want := []string{"-", "user", "-c", "sh", "-c", "env 'DISPLAY=:0' 'XAUTHORITY=/home/user/.Xauthority' '/opt/discord/Discord'"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("realUserArgs() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,338 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	path "path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// A release source is where Bashcord releases come from. It can be given as
+//
+//	owner/repo[@tag]          a GitHub repository, latest release if no tag
+//	https://mirror/bashcord/  a mirror serving manifest.json
+//	file:///some/dir          a local directory, with or without manifest.json
+//
+// manifest.json has the same shape as a GitHub release. Relative asset urls
+// are resolved against the mirror.
+const ManifestFileName = "manifest.json"
+
+type ReleaseSource interface {
+	// FetchRelease returns the release to install. Its asset urls are absolute
+	FetchRelease() (*GithubRelease, error)
+	// ListReleases returns all available releases, newest first
+	ListReleases() ([]*GithubRelease, error)
+	String() string
+}
+
+type GithubSource struct {
+	Owner, Repo string
+	// Tag is empty for the latest release
+	Tag string
+}
+
+func (s *GithubSource) String() string {
+	if s.Tag == "" {
+		return s.Owner + "/" + s.Repo
+	}
+	return s.Owner + "/" + s.Repo + "@" + s.Tag
+}
+
+func (s *GithubSource) ReleaseURL() string {
+	base := GithubApiUrl + "/repos/" + url.PathEscape(s.Owner) + "/" + url.PathEscape(s.Repo) + "/releases/"
+	if s.Tag == "" {
+		return base + "latest"
+	}
+	return base + "tags/" + url.PathEscape(s.Tag)
+}
+
+func (s *GithubSource) FetchRelease() (*GithubRelease, error) {
+	release, err := GetGithubRelease(s.ReleaseURL())
+	if err != nil {
+		return nil, err
+	}
+	return release, release.checkAssetURLs(false)
+}
+
+func (s *GithubSource) ListReleases() ([]*GithubRelease, error) {
+	var releases []*GithubRelease
+	if err := getGithubJSON(GithubApiUrl+"/repos/"+url.PathEscape(s.Owner)+"/"+url.PathEscape(s.Repo)+"/releases?per_page=100", &releases); err != nil {
+		return nil, err
+	}
+	for _, r := range releases {
+		if err := r.checkAssetURLs(false); err != nil {
+			return nil, err
+		}
+	}
+	return releases, nil
+}
+
+type MirrorSource struct {
+	// Base always ends with a slash
+	Base *url.URL
+}
+
+func (s *MirrorSource) String() string {
+	return s.Base.String()
+}
+
+func (s *MirrorSource) FetchRelease() (*GithubRelease, error) {
+	manifest := s.Base.JoinPath(ManifestFileName)
+
+	var release *GithubRelease
+	var err error
+	if dir := s.localDir(); dir != "" && !ExistsFile(path.Join(dir, ManifestFileName)) {
+		release, err = releaseFromDir(dir)
+	} else {
+		release, err = GetGithubRelease(manifest.String())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range release.Assets {
+		ref, err := url.Parse(release.Assets[i].DownloadURL)
+		if err != nil {
+			return nil, errors.New("Invalid url for " + release.Assets[i].Name + " in " + manifest.String())
+		}
+		release.Assets[i].DownloadURL = s.Base.ResolveReference(ref).String()
+	}
+	return release, release.checkAssetURLs(s.localDir() != "")
+}
+
+// ListReleases returns the only release of the mirror
+func (s *MirrorSource) ListReleases() ([]*GithubRelease, error) {
+	release, err := s.FetchRelease()
+	if err != nil {
+		return nil, err
+	}
+	return []*GithubRelease{release}, nil
+}
+
+// localDir returns the directory of file:// sources
+func (s *MirrorSource) localDir() string {
+	if s.Base.Scheme != "file" {
+		return ""
+	}
+	return localPath(s.Base.Path)
+}
+
+// releaseFromDir makes up a release from the files in dir, taking the hash
+// from desktop.asar
+func releaseFromDir(dir string) (*GithubRelease, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	release := &GithubRelease{TagName: path.Base(dir)}
+	for _, f := range files {
+		if !f.Type().IsRegular() {
+			continue
+		}
+		release.Assets = append(release.Assets, GithubAsset{
+			Name:        f.Name(),
+			DownloadURL: (&url.URL{Path: f.Name()}).String(),
+		})
+	}
+
+	hash, err := ReadEquicordHash(path.Join(dir, "desktop.asar"))
+	if err != nil {
+		return nil, err
+	}
+	release.Name = "Bashcord " + hash
+	return release, nil
+}
+
+// ParseReleaseSource parses a release source as described above
+func ParseReleaseSource(spec string) (ReleaseSource, error) {
+	if strings.Contains(spec, "://") {
+		base, err := url.Parse(spec)
+		if err != nil {
+			return nil, errors.New("Invalid release source " + spec + ": " + err.Error())
+		}
+		switch base.Scheme {
+		case "http", "https":
+			if base.Host == "" {
+				return nil, errors.New("Invalid release source " + spec + ": no host")
+			}
+		case "file":
+			if base.Host != "" && base.Host != "localhost" {
+				return nil, errors.New("Invalid release source " + spec + ": only local file urls are supported")
+			}
+		default:
+			return nil, errors.New("Invalid release source " + spec + ": unsupported scheme " + base.Scheme)
+		}
+		if !strings.HasSuffix(base.Path, "/") {
+			base.Path += "/"
+		}
+		return &MirrorSource{base}, nil
+	}
+
+	repo, tag, _ := strings.Cut(spec, "@")
+	owner, repo, ok := strings.Cut(repo, "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return nil, errors.New("Invalid release source " + spec + ": expected owner/repo[@tag], an https url or a file:// url")
+	}
+	return &GithubSource{owner, repo, tag}, nil
+}
+
+// Channels maps release channels to their release source
+var Channels = map[string]string{
+	DefaultChannel: DefaultReleaseSource,
+	"beta":         "BashOnZsh/Bashcord@Beta",
+	"nightly":      "BashOnZsh/Bashcord@Nightly",
+}
+
+const DefaultChannel = "stable"
+
+// channelSources returns the release source of every channel, including
+// the ones added by the config file
+func channelSources(config *Config) map[string]string {
+	sources := maps.Clone(Channels)
+	maps.Copy(sources, config.Channels)
+	return sources
+}
+
+// ChannelNames returns the names of all channels, stable first
+func ChannelNames() []string {
+	config, err := ReadConfig()
+	if err != nil {
+		config = &Config{}
+	}
+
+	var names []string
+	for name := range channelSources(config) {
+		if name != DefaultChannel {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return Prepend(names, DefaultChannel)
+}
+
+// GetChannel returns the active release channel. The --channel flag takes
+// precedence over the BASHCORD_CHANNEL environment variable, which takes
+// precedence over the channel saved in the config file
+func GetChannel() string {
+	if channelArg != "" {
+		return channelArg
+	}
+	if channel := os.Getenv("BASHCORD_CHANNEL"); channel != "" {
+		return channel
+	}
+	if config, err := ReadConfig(); err == nil && config.Channel != "" {
+		return config.Channel
+	}
+	return DefaultChannel
+}
+
+// SaveChannel makes channel the default for future runs
+func SaveChannel(channel string) error {
+	if !SliceContains(ChannelNames(), channel) {
+		return errors.New("Unknown release channel " + channel)
+	}
+
+	config, err := ReadConfig()
+	if err != nil {
+		return err
+	}
+	config.Channel = channel
+	return config.Save()
+}
+
+// GetReleaseSource returns the configured release source. The
+// --release-source flag takes precedence over the BASHCORD_RELEASE_SOURCE
+// environment variable, which takes precedence over the config file. If none
+// of them is set, the source of the active channel is used
+func GetReleaseSource() (ReleaseSource, error) {
+	config, err := ReadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	spec := releaseSourceArg
+	if spec == "" {
+		spec = os.Getenv("BASHCORD_RELEASE_SOURCE")
+	}
+	if spec == "" {
+		spec = config.ReleaseSource
+	}
+	if spec == "" {
+		channel := GetChannel()
+		var ok bool
+		if spec, ok = channelSources(config)[channel]; !ok {
+			return nil, errors.New("Unknown release channel " + channel)
+		}
+	}
+
+	source, err := ParseReleaseSource(spec)
+	if err == nil && spec != DefaultReleaseSource {
+		Log.Info("Using release source", source)
+	}
+	return source, err
+}
+
+// localPath turns the path of a file:// url into a filesystem path
+func localPath(p string) string {
+	// file:///C:/foo has the path /C:/foo
+	if runtime.GOOS == "windows" && len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return path.FromSlash(p)
+}
+
+// LocalFileURL returns the file:// url of the file p
+func LocalFileURL(p string) string {
+	p = path.ToSlash(p)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// checkAssetURLs makes sure the assets of r are downloaded over http(s), or
+// from local files if r comes from a file:// source. Anything else, like a
+// mirror pointing at files on this machine, is refused
+func (r *GithubRelease) checkAssetURLs(local bool) error {
+	for _, ass := range r.Assets {
+		u, err := url.Parse(ass.DownloadURL)
+		if err != nil {
+			return errors.New("Invalid url for " + ass.Name + " in release " + r.TagName)
+		}
+		if u.Scheme != "https" && u.Scheme != "http" && (u.Scheme != "file" || !local) {
+			return errors.New("Refusing to download " + ass.Name + " of release " + r.TagName + " from " + ass.DownloadURL)
+		}
+	}
+	return nil
+}
+
+type localFileSystem struct{}
+
+func (localFileSystem) Open(name string) (http.File, error) {
+	return os.Open(localPath(name))
+}
+
+// fileClient fetches file:// urls, range requests included. Only the urls of
+// file:// release sources get there, see checkAssetURLs
+var fileClient = &http.Client{Transport: http.NewFileTransport(localFileSystem{})}
+
+// httpClient returns the client fetching u. http.DefaultClient can't read
+// local files, not even when a server redirects it to one
+func httpClient(u string) *http.Client {
+	if strings.HasPrefix(u, "file:") {
+		return fileClient
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,60 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	path "path/filepath"
+	"testing"
+)
+
+func TestLocalFilesOnlyFromFileSources(t *testing.T) {
+	dir := t.TempDir()
+	secret := path.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"tag_name":"v1","assets":[{"name":"desktop.asar","browser_download_url":"` + LocalFileURL(secret) + `"}]}`
+	if err := os.WriteFile(path.Join(dir, ManifestFileName), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, LocalFileURL(secret), http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte(manifest))
+	}))
+	defer srv.Close()
+
+	mirror, err := ParseReleaseSource(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = mirror.FetchRelease(); err == nil {
+		t.Error("a mirror got to point at a local file")
+	}
+	if _, err = fetchSmallAsset(srv.URL + "/redirect"); err == nil {
+		t.Error("a mirror got to redirect to a local file")
+	}
+
+	local, err := ParseReleaseSource(LocalFileURL(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, err := local.FetchRelease()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fetchSmallAsset(release.AssetURL("desktop.asar"))
+	if err != nil || string(b) != "secret" {
+		t.Errorf("file:// source asset = %q, %v", b, err)
+	}
+}
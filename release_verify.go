@@ -0,0 +1,238 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"vencord/buildinfo"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	ChecksumsAssetName = "SHA256SUMS"
+	// Either a minisign signature or a base64 raw ed25519 signature of SHA256SUMS
+	MinisignAssetName  = ChecksumsAssetName + ".minisig"
+	SignatureAssetName = ChecksumsAssetName + ".sig"
+)
+
+// maxAssetSize limits how much of small metadata assets we read into memory
+const maxAssetSize = 1024 * 1024
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// SkipReleaseVerification disables all checks. Only meant for testing unsigned builds
+var SkipReleaseVerification = os.Getenv("BASHCORD_INSECURE_SKIP_VERIFY") == "1"
+
+func (r *GithubRelease) AssetURL(name string) string {
+	for _, ass := range r.Assets {
+		if ass.Name == name {
+			return ass.DownloadURL
+		}
+	}
+	return ""
+}
+
+func fetchSmallAsset(url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	res, err := httpClient(url).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return nil, errors.New(res.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxAssetSize+1))
+	if err == nil && len(b) > maxAssetSize {
+		err = errors.New("asset is too large")
+	}
+	return b, err
+}
+
+// ParseChecksums parses the output of sha256sum: "<hex>  <name>" per line,
+// with an optional * before the name for binary mode
+func ParseChecksums(b []byte) map[string]string {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if !ok {
+			continue
+		}
+		name = strings.TrimPrefix(strings.TrimLeft(name, " "), "*")
+		sums[name] = strings.ToLower(sum)
+	}
+	return sums
+}
+
+// FetchReleaseChecksums downloads the checksums of release and verifies their
+// signature
+func FetchReleaseChecksums(release *GithubRelease) (map[string]string, error) {
+	url := release.AssetURL(ChecksumsAssetName)
+	if url == "" {
+		return nil, errors.New("Release " + release.TagName + " has no " + ChecksumsAssetName + ", refusing to install unverified files")
+	}
+
+	Log.Debug("Downloading", ChecksumsAssetName)
+	sums, err := fetchSmallAsset(url)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download %s: %w", ChecksumsAssetName, err)
+	}
+
+	return checkChecksums("Release "+release.TagName, sums, func(name string) ([]byte, error) {
+		url := release.AssetURL(name)
+		if url == "" {
+			return nil, nil
+		}
+		Log.Debug("Downloading", name)
+		sig, err := fetchSmallAsset(url)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to download %s: %w", name, err)
+		}
+		return sig, nil
+	})
+}
+
+// checkChecksums verifies the signature of sums and parses them. getSig
+// returns the signature asset name of source, or nil if it has none
+func checkChecksums(source string, sums []byte, getSig func(name string) ([]byte, error)) (map[string]string, error) {
+	if buildinfo.ReleasePublicKey == "" {
+		return nil, errors.New("This build has no release public key to check " + ChecksumsAssetName + " of " + source + " with, refusing to install unverified files. Set BASHCORD_INSECURE_SKIP_VERIFY=1 to install anyway")
+	}
+
+	for _, name := range []string{MinisignAssetName, SignatureAssetName} {
+		sig, err := getSig(name)
+		if err != nil {
+			return nil, err
+		}
+		if sig == nil {
+			continue
+		}
+
+		if err = VerifySignature(buildinfo.ReleasePublicKey, sums, sig); err != nil {
+			return nil, fmt.Errorf("Invalid signature of %s: %w", ChecksumsAssetName, err)
+		}
+		Log.Debug("Signature of", ChecksumsAssetName, "is valid")
+		return ParseChecksums(sums), nil
+	}
+
+	return nil, errors.New(source + " has no signature for " + ChecksumsAssetName + ", refusing to install unverified files")
+}
+
+// VerifyChecksum checks that sha256Hex is the checksum of name in sums
+func VerifyChecksum(sums map[string]string, name, sha256Hex string) error {
+	want, ok := sums[name]
+	if !ok {
+		return errors.New(ChecksumsAssetName + " has no checksum for " + name)
+	}
+	if want != sha256Hex {
+		return fmt.Errorf("%w for %s: expected %s but got %s", ErrChecksumMismatch, name, want, sha256Hex)
+	}
+	return nil
+}
+
+// VerifySignature verifies sig over msg with pubKey. pubKey is either a
+// minisign public key, in which case sig must be a .minisig file, or a raw
+// base64 ed25519 key with sig being a base64 (or raw) ed25519 signature
+func VerifySignature(pubKey string, msg, sig []byte) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lastLine(pubKey)))
+	if err != nil {
+		return errors.New("malformed public key")
+	}
+
+	switch len(key) {
+	case ed25519.PublicKeySize:
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil {
+			raw = sig
+		}
+		if len(raw) != ed25519.SignatureSize || !ed25519.Verify(key, msg, raw) {
+			return errors.New("signature does not match")
+		}
+		return nil
+	case 2 + 8 + ed25519.PublicKeySize:
+		return verifyMinisign(key, msg, sig)
+	default:
+		return errors.New("malformed public key")
+	}
+}
+
+// verifyMinisign implements https://jedisct1.github.io/minisign/#signature-format
+func verifyMinisign(key, msg, sigFile []byte) error {
+	if string(key[:2]) != "Ed" {
+		return errors.New("unsupported public key algorithm")
+	}
+	keyID, pub := key[2:10], ed25519.PublicKey(key[10:])
+
+	lines := strings.Split(strings.ReplaceAll(string(sigFile), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[0], "untrusted comment:") || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("malformed minisign signature")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("malformed minisign signature")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("malformed minisign signature")
+	}
+
+	if !bytes.Equal(sig[2:10], keyID) {
+		return errors.New("signed with a different key (id " + hex.EncodeToString(reverse(sig[2:10])) + ")")
+	}
+
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		sum := blake2b.Sum512(msg)
+		msg = sum[:]
+	default:
+		return errors.New("unsupported signature algorithm")
+	}
+
+	if !ed25519.Verify(pub, msg, sig[10:]) {
+		return errors.New("signature does not match")
+	}
+
+	trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	if !ed25519.Verify(pub, append(bytes.Clone(sig[10:]), trustedComment...), globalSig) {
+		return errors.New("trusted comment signature does not match")
+	}
+	return nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	return s[strings.LastIndex(s, "\n")+1:]
+}
+
+// reverse is used to print minisign key ids, which are stored little endian
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
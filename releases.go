@@ -0,0 +1,112 @@
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var hashRegex = regexp.MustCompile(`\b[0-9a-f]{7,40}\b`)
+
+// Hash returns the Bashcord git hash of r, the last one in its name, which is
+// usually "Bashcord <hash>", or else in its tag. Empty if neither has one, the
+// hash is only known once installed then, see installedHash
+func (r *GithubRelease) Hash() string {
+	for _, s := range []string{r.Name, r.TagName} {
+		if hashes := hashRegex.FindAllString(s, -1); len(hashes) > 0 {
+			return hashes[len(hashes)-1]
+		}
+	}
+	return ""
+}
+
+// IsInstalled returns whether r is the installed Bashcord
+func (r *GithubRelease) IsInstalled() bool {
+	if hash := r.Hash(); hash != "" {
+		return hash == InstalledHash
+	}
+	return r.TagName == ReleaseData.TagName && LatestHash == InstalledHash
+}
+
+// installedHash returns the hash of release once installed to dir
+func installedHash(release *GithubRelease, dir string) string {
+	if hash := release.Hash(); hash != "" {
+		return hash
+	}
+	hash, err := ReadEquicordHash(dir)
+	if err != nil {
+		Log.Warn(err)
+		return "Unknown"
+	}
+	return hash
+}
+
+// SelectRelease makes r the release that gets installed
+func SelectRelease(r *GithubRelease) {
+	ReleaseData = *r
+	LatestHash = Ternary(r.Hash() != "", r.Hash(), "Unknown")
+	Log.Debug("Selected release", r.TagName, "("+LatestHash+")")
+}
+
+// ListReleases lists the releases of the configured release source, newest first
+func ListReleases() ([]*GithubRelease, error) {
+	source, err := GetReleaseSource()
+	if err != nil {
+		return nil, err
+	}
+	return source.ListReleases()
+}
+
+// FindRelease returns the release with the tag or hash (prefix) version
+func FindRelease(releases []*GithubRelease, version string) *GithubRelease {
+	for _, r := range releases {
+		if r.TagName == version {
+			return r
+		}
+	}
+	for _, r := range releases {
+		if len(version) >= 7 && strings.HasPrefix(r.Hash(), version) {
+			return r
+		}
+	}
+	return nil
+}
+
+// FetchReleaseVersion returns the release of source with the tag or hash version
+func FetchReleaseVersion(source ReleaseSource, version string) (*GithubRelease, error) {
+	releases, err := source.ListReleases()
+	if err != nil {
+		return nil, err
+	}
+	if r := FindRelease(releases, version); r != nil {
+		return r, nil
+	}
+	return nil, errors.New("No release " + version + " in " + source.String())
+}
+
+// RollbackBuild reinstalls the Bashcord build the last install replaced. The
+// build it rolls back from is kept in turn, so doing it again undoes it
+func RollbackBuild() error {
+	prev := EquicordDirectory + ".prev"
+	if !ExistsFile(prev) {
+		return errors.New("No previous Bashcord version to roll back to")
+	}
+
+	from := InstalledHash
+	hash, err := ReadEquicordHash(prev)
+	if err != nil {
+		return err
+	}
+	// Verified when it was installed
+	if err = installAsarFile(prev, hash, nil); err != nil {
+		return err
+	}
+	Log.Info("Rolled back from Bashcord", from, "to", InstalledHash)
+	return nil
+}
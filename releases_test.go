@@ -0,0 +1,51 @@
+//go:build linux
+
+/*
+ * SPDX-License-Identifier: GPL-3.0
+ * Vencord Installer, a cross platform gui/cli app for installing Vencord
+ * Copyright (c) 2023 Vendicated and Vencord contributors
+ */
+
+package main
+
+import "testing"
+
+func TestReleaseHash(t *testing.T) {
+	for _, tt := range []struct{ name, tag, want string }{
+		{"Bashcord 1a2b3c4", "v1", "1a2b3c4"},
+		{"Bashcord 1a2b3c4 (hotfix)", "v1", "1a2b3c4"},
+		{"Bashcord build 9f8e7d6a", "latest", "9f8e7d6a"},
+		{"Nightly", "9f8e7d6", "9f8e7d6"},
+		{"Bashcord v1.2", "v1.2", ""},
+		{"", "", ""},
+	} {
+		r := &GithubRelease{Name: tt.name, TagName: tt.tag}
+		if got := r.Hash(); got != tt.want {
+			t.Errorf("Hash() of %q (%s) = %q, want %q", tt.name, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestInstallReleaseWithoutHash(t *testing.T) {
+	fx := newFixture(t)
+	oldRelease, oldSkip := ReleaseData, SkipReleaseVerification
+	t.Cleanup(func() { ReleaseData, SkipReleaseVerification = oldRelease, oldSkip })
+	SkipReleaseVerification = true
+
+	url := "https://example.com/v2/desktop.asar"
+	fx.exec.downloads = map[string][]byte{url: makeAsar("// Equicord 9f8e7d6")}
+	r := &GithubRelease{Name: "Bashcord v2 (stable)", TagName: "v2", Assets: []GithubAsset{{Name: "desktop.asar", DownloadURL: url}}}
+	other := &GithubRelease{Name: "Bashcord 1a2b3c4", TagName: "v1"}
+	SelectRelease(r)
+	if !other.IsInstalled() || r.IsInstalled() {
+		t.Errorf("v1 installed %v and v2 %v before installing v2", other.IsInstalled(), r.IsInstalled())
+	}
+
+	fx.must(installLatestBuilds())
+	if InstalledHash != "9f8e7d6" || LatestHash != "9f8e7d6" {
+		t.Errorf("installed %s, latest %s, want the hash of the asar 9f8e7d6", InstalledHash, LatestHash)
+	}
+	if other.IsInstalled() || !r.IsInstalled() {
+		t.Errorf("v1 installed %v and v2 %v after installing v2", other.IsInstalled(), r.IsInstalled())
+	}
+}
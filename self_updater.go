@@ -27,13 +27,17 @@ func init() {
 		Log.Debug("Disabling self updater as this is not a release build")
 		return
 	}
+	if OfflineInstallRequested() {
+		Log.Debug("Disabling self updater for offline install")
+		return
+	}
 
 	go DeleteOldExecutable()
 
 	go func() {
 		Log.Debug("Checking for Installer Updates...")
 
-		res, err := GetGithubRelease(InstallerReleaseUrl)
+		res, err := InstallerReleaseSource.FetchRelease()
 		if err != nil {
 			Log.Warn("Failed to check for self updates:", err)
 			SelfUpdateCheckDoneChan <- false
@@ -99,7 +103,7 @@ func UpdateSelf() error {
 		_ = os.Remove(tmp.Name())
 	}()
 	if err = tmp.Chmod(0o755); err != nil {
-		return fmt.Errorf("Failed to chmod 755", tmp.Name()+":", err)
+		return fmt.Errorf("Failed to chmod 755 %s: %w", tmp.Name(), err)
 	}
 
 	if _, err = io.Copy(tmp, res.Body); err != nil {
@@ -9,6 +9,7 @@ package main
 import (
 	"errors"
 	"os"
+	path "path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
@@ -22,6 +23,16 @@ func SliceMap[T, U any](arr []T, mapper func(T) U) []U {
 	return result
 }
 
+func SliceFilter[T any](arr []T, fn func(T) bool) []T {
+	var result []T
+	for _, e := range arr {
+		if fn(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
 func SliceIndexFunc[T any](slice []T, fn func(T) bool) int {
 	for i, e := range slice {
 		if fn(e) {
@@ -45,14 +56,24 @@ func SliceContains[T comparable](slice []T, item T) bool {
 	return SliceIndex(slice, item) != -1
 }
 
+// Values of the command line flags that library code needs, set by the CLI
+// once it parsed them. The GUI has no flags and leaves them empty
+var (
+	channelArg       string // --channel
+	releaseSourceArg string // --release-source
+	versionArg       string // --version <tag|hash>
+	offlineArg       string // --from-file or --from-bundle
+	searchDepthArg   int    // --search-depth, 0 when not given
+)
+
 func ExistsFile(path string) bool {
-	_, err := os.Stat(path)
+	_, err := FS.Stat(path)
 	Log.Debug("Checking if", path, "exists:", Ternary(err == nil, "Yes", "No"))
 	return err == nil
 }
 
 func IsDirectory(path string) bool {
-	s, err := os.Stat(path)
+	s, err := FS.Stat(path)
 	if err != nil {
 		Log.Error("Error while checking if", path, "is directory:", err)
 		return false
@@ -61,6 +82,13 @@ func IsDirectory(path string) bool {
 	return s.IsDir()
 }
 
+// shellQuote joins args into a command line for sh
+func shellQuote(args []string) string {
+	return strings.Join(SliceMap(args, func(arg string) string {
+		return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}), " ")
+}
+
 func Ternary[T any](b bool, ifTrue, ifFalse T) T {
 	if b {
 		return ifTrue
@@ -105,3 +133,32 @@ func CheckIfErrIsCauseItsBusyRn(err error) error {
 func Prepend[T any](slice []T, elems ...T) []T {
 	return append(elems, slice...)
 }
+
+// WriteFileAtomic writes data to a temporary file next to name and renames it
+// into place, so readers never see a partially written file
+func WriteFileAtomic(name string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(path.Dir(name), "."+path.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	return err
+}